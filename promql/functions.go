@@ -20,6 +20,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/regexp"
@@ -28,6 +29,8 @@ import (
 	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+	"github.com/prometheus/prometheus/util/annotations"
 	"github.com/prometheus/prometheus/util/notes"
 )
 
@@ -79,17 +82,23 @@ func extrapolatedRate(vals []parser.Value, args parser.Expressions, enh *EvalNod
 		ns                 = notes.Notes{}
 	)
 
+	metricName := samples.Metric.Get(labels.MetricName)
+
 	// We need either at least two Histograms and no Floats, or at least two
 	// Floats and no Histograms to calculate a rate. Otherwise, drop this
 	// Vector element.
 	if len(samples.Histograms) > 0 && len(samples.Floats) > 0 {
-		// Mix of histograms and floats. TODO(beorn7): Communicate this failure reason.
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(metricName, len(samples.Floats), len(samples.Histograms)))
 		return enh.Out, ns
 	}
 
-	metricName := samples.Metric.Get(labels.MetricName)
-	if isCounter && !strings.HasSuffix(metricName, "_total") && !strings.HasSuffix(metricName, "_sum") && !strings.HasSuffix(metricName, "_count") {
-		ns.AddWarning(notes.NewPossibleNonCounterWarning(metricName))
+	if isCounter && !strings.HasSuffix(metricName, "_total") {
+		switch {
+		case strings.HasSuffix(metricName, "_sum") || strings.HasSuffix(metricName, "_count"):
+			ns.AddInfo(notes.NewPossibleNonCounterInfo(metricName))
+		default:
+			ns.AddWarning(notes.NewPossibleNonCounterWarning(metricName))
+		}
 	}
 
 	switch {
@@ -98,11 +107,10 @@ func extrapolatedRate(vals []parser.Value, args parser.Expressions, enh *EvalNod
 		firstT = samples.Histograms[0].T
 		lastT = samples.Histograms[numSamplesMinusOne].T
 		var newNs notes.Notes
-		resultHistogram, newNs = histogramRate(samples.Histograms, isCounter)
+		resultHistogram, newNs = histogramRate(samples.Histograms, isCounter, metricName)
+		ns.Merge(newNs)
 		if resultHistogram == nil {
 			// The histograms are not compatible with each other.
-			// TODO(beorn7): Communicate this failure reason.
-			ns.Merge(newNs)
 			return enh.Out, ns
 		}
 	case len(samples.Floats) > 1:
@@ -113,7 +121,12 @@ func extrapolatedRate(vals []parser.Value, args parser.Expressions, enh *EvalNod
 		if !isCounter {
 			break
 		}
-		// Handle counter resets:
+		// Handle counter resets. Unlike histogramRate above, FPoint carries no
+		// CounterResetHint, so there is no scrape-loop-provided signal to
+		// prefer at the chunk boundary here: this remains the pure
+		// value-based heuristic, and a first/last sample that looks like a
+		// reset but isn't (or vice versa) is still misjudged the same way it
+		// always has been.
 		prevValue := samples.Floats[0].F
 		for _, currPoint := range samples.Floats[1:] {
 			if currPoint.F < prevValue {
@@ -164,6 +177,9 @@ func extrapolatedRate(vals []parser.Value, args parser.Expressions, enh *EvalNod
 	} else {
 		extrapolateToInterval += averageDurationBetweenSamples / 2
 	}
+	if maxEdgeFactor := math.Max(durationToStart, durationToEnd) / averageDurationBetweenSamples; maxEdgeFactor > 1.1 {
+		ns.AddInfo(notes.NewRateExtrapolationInfo(metricName, maxEdgeFactor))
+	}
 	factor := extrapolateToInterval / sampledInterval
 	if isRate {
 		factor /= ms.Range.Seconds()
@@ -180,7 +196,7 @@ func extrapolatedRate(vals []parser.Value, args parser.Expressions, enh *EvalNod
 // histogramRate is a helper function for extrapolatedRate. It requires
 // points[0] to be a histogram. It returns nil if any other Point in points is
 // not a histogram.
-func histogramRate(points []HPoint, isCounter bool) (*histogram.FloatHistogram, notes.Notes) {
+func histogramRate(points []HPoint, isCounter bool, metricName string) (*histogram.FloatHistogram, notes.Notes) {
 	prev := points[0].H
 	last := points[len(points)-1].H
 	if last == nil {
@@ -190,18 +206,31 @@ func histogramRate(points []HPoint, isCounter bool) (*histogram.FloatHistogram,
 	if last.Schema < minSchema {
 		minSchema = last.Schema
 	}
+	ns := notes.Notes{}
+
+	// The boundary samples are exactly the ones this feature is meant to
+	// scrutinize (a conflicting hint on the first or last sample of the
+	// range is the chunk-boundary case), so check them up front rather than
+	// relying on the schema-detection loop below, which deliberately skips
+	// them since prev/last are already accounted for above.
+	if counterResetHintConflicts(isCounter, prev.CounterResetHint) {
+		ns.AddInfo(notes.NewCounterResetHintMismatchInfo(metricName))
+	}
+	if counterResetHintConflicts(isCounter, last.CounterResetHint) {
+		ns.AddInfo(notes.NewCounterResetHintMismatchInfo(metricName))
+	}
 
 	// First iteration to find out two things:
 	// - What's the smallest relevant schema?
 	// - Are all data points histograms?
-	//   TODO(beorn7): Find a way to check that earlier, e.g. by handing in a
-	//   []FloatPoint and a []HistogramPoint separately.
 	for _, currPoint := range points[1 : len(points)-1] {
 		curr := currPoint.H
 		if curr == nil {
 			return nil, notes.CreateNotesWithWarning(notes.MixedFloatsHistogramsWarning)
 		}
-		// TODO(trevorwhitney): Check if isCounter is consistent with curr.CounterResetHint.
+		if counterResetHintConflicts(isCounter, curr.CounterResetHint) {
+			ns.AddInfo(notes.NewCounterResetHintMismatchInfo(metricName))
+		}
 		if !isCounter {
 			continue
 		}
@@ -214,18 +243,46 @@ func histogramRate(points []HPoint, isCounter bool) (*histogram.FloatHistogram,
 	h.Sub(prev)
 
 	if isCounter {
-		// Second iteration to deal with counter resets.
+		// Second iteration to deal with counter resets. Prefer the
+		// CounterResetHint over the value-based heuristic whenever the scrape
+		// loop has told us definitively: NotCounterReset overrides a value
+		// drop caused by out-of-order samples at a chunk boundary, and
+		// CounterReset forces compensation even when the value happens not
+		// to have dropped.
 		for _, currPoint := range points[1:] {
 			curr := currPoint.H
-			if curr.DetectReset(prev) {
+			switch curr.CounterResetHint {
+			case histogram.CounterReset:
 				h.Add(prev)
+			case histogram.NotCounterReset:
+				// Trust the hint: no reset, even if curr.DetectReset(prev)
+				// would have said otherwise.
+			default:
+				if curr.DetectReset(prev) {
+					h.Add(prev)
+				}
 			}
 			prev = curr
 		}
 	}
 
 	h.CounterResetHint = histogram.GaugeType
-	return h.Compact(0), notes.Notes{}
+	return h.Compact(0), ns
+}
+
+// counterResetHintConflicts reports whether hint actively disagrees with
+// isCounter, e.g. a rate() call (isCounter true) over a series whose samples
+// are hinted as a gauge, or a delta() call (isCounter false) over samples
+// hinted as carrying a counter reset.
+func counterResetHintConflicts(isCounter bool, hint histogram.CounterResetHint) bool {
+	switch hint {
+	case histogram.GaugeType:
+		return isCounter
+	case histogram.CounterReset, histogram.NotCounterReset:
+		return !isCounter
+	default:
+		return false
+	}
 }
 
 // === delta(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
@@ -354,6 +411,76 @@ func funcHoltWinters(vals []parser.Value, args parser.Expressions, enh *EvalNode
 	return append(enh.Out, Sample{F: s1}), notes.Notes{}
 }
 
+// holtWintersMean returns the Kahan-compensated mean of samples[from:to].
+func holtWintersMean(samples []FPoint, from, to int) float64 {
+	var sum, c float64
+	for _, f := range samples[from:to] {
+		sum, c = kahanSumInc(f.F, sum, c)
+	}
+	return (sum + c) / float64(to-from)
+}
+
+// === holt_winters_seasonal(v range-vector, sf, tf, seasonal_factor scalar, period scalar) (Vector, Notes) ===
+// funcHoltWintersSeasonal implements additive triple exponential smoothing (Holt-Winters
+// with a seasonal component), so that metrics with a daily/weekly cycle can be forecast
+// one step beyond the queried range, unlike funcHoltWinters which only models level+trend.
+func funcHoltWintersSeasonal(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	samples := vals[0].(Matrix)[0]
+	sf := vals[1].(Vector)[0].F
+	tf := vals[2].(Vector)[0].F
+	seasonalFactor := vals[3].(Vector)[0].F
+	period := vals[4].(Vector)[0].F
+
+	if sf <= 0 || sf >= 1 {
+		panic(fmt.Errorf("invalid smoothing factor. Expected: 0 < sf < 1, got: %f", sf))
+	}
+	if tf <= 0 || tf >= 1 {
+		panic(fmt.Errorf("invalid trend factor. Expected: 0 < tf < 1, got: %f", tf))
+	}
+	if seasonalFactor <= 0 || seasonalFactor >= 1 {
+		panic(fmt.Errorf("invalid seasonal factor. Expected: 0 < seasonal_factor < 1, got: %f", seasonalFactor))
+	}
+
+	n := len(samples.Floats)
+	// Need at least two full periods to establish a level, a trend, and a
+	// seasonal index for every phase of the period. Drop this Vector element
+	// otherwise.
+	if n < 2 {
+		return enh.Out, notes.CreateNotesWithWarning(notes.RangeTooShortWarning)
+	}
+	avgInterval := float64(samples.Floats[n-1].T-samples.Floats[0].T) / 1000 / float64(n-1)
+	l := 0
+	if avgInterval > 0 {
+		l = int(math.Round(period / avgInterval))
+	}
+	if l < 1 || n < 2*l {
+		return enh.Out, notes.CreateNotesWithWarning(notes.RangeTooShortWarning)
+	}
+
+	level := holtWintersMean(samples.Floats, 0, l)
+	trend := (holtWintersMean(samples.Floats, l, 2*l) - level) / float64(l)
+	// cLevel/cTrend carry the Kahan compensation for the level/trend running
+	// sums across the recurrence below, the same numerical care holtWintersMean
+	// already applies to the initial means. Each step folds the previous
+	// compensation into prevLevel/prevTrend, so every addition starts afresh.
+	var cLevel, cTrend float64
+
+	seasonal := make([]float64, n)
+	for i := 0; i < l; i++ {
+		seasonal[i] = samples.Floats[i].F - level
+	}
+
+	for i := l; i < n; i++ {
+		x := samples.Floats[i].F
+		prevLevel, prevTrend := level+cLevel, trend+cTrend
+		level, cLevel = kahanSumInc(sf*(x-seasonal[i-l]), (1-sf)*(prevLevel+prevTrend), 0)
+		trend, cTrend = kahanSumInc(tf*(level-prevLevel), (1-tf)*prevTrend, 0)
+		seasonal[i] = seasonalFactor*(x-level) + (1-seasonalFactor)*seasonal[i-l]
+	}
+
+	return append(enh.Out, Sample{F: level + cLevel + trend + cTrend + seasonal[n-l]}), notes.Notes{}
+}
+
 // === sort(node parser.ValueTypeVector) (Vector, Notes) ===
 func funcSort(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
 	// NaN should sort to the bottom, so take descending sort with NaN first and
@@ -372,6 +499,28 @@ func funcSortDesc(vals []parser.Value, args parser.Expressions, enh *EvalNodeHel
 	return Vector(byValueSorter), notes.Notes{}
 }
 
+// === sort_by_label(node parser.ValueTypeVector, label ...string) (Vector, Notes) ===
+func funcSortByLabel(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	lbls := make([]string, len(args)-1)
+	for i := 1; i < len(args); i++ {
+		lbls[i-1] = stringFromArg(args[i])
+	}
+	byLabelSorter := vectorByLabelHeap{vector: vals[0].(Vector), labels: lbls}
+	sort.Sort(byLabelSorter)
+	return byLabelSorter.vector, notes.Notes{}
+}
+
+// === sort_by_label_desc(node parser.ValueTypeVector, label ...string) (Vector, Notes) ===
+func funcSortByLabelDesc(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	lbls := make([]string, len(args)-1)
+	for i := 1; i < len(args); i++ {
+		lbls[i-1] = stringFromArg(args[i])
+	}
+	byLabelSorter := vectorByLabelHeap{vector: vals[0].(Vector), labels: lbls}
+	sort.Sort(sort.Reverse(byLabelSorter))
+	return byLabelSorter.vector, notes.Notes{}
+}
+
 // === clamp(Vector parser.ValueTypeVector, min, max Scalar) (Vector, Notes) ===
 func funcClamp(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
 	vec := vals[0].(Vector)
@@ -458,14 +607,96 @@ func aggrHistOverTime(vals []parser.Value, enh *EvalNodeHelper, aggrFn func(Seri
 	return append(enh.Out, Sample{H: aggrFn(el)})
 }
 
+// histogramSchemaCompatNotes scans points for native-histogram schema
+// mismatches that a pairwise Add/Sub merge cannot combine correctly:
+// exponential mixed with custom buckets, or two custom-bucket histograms with
+// different bounds. The corresponding util/annotations constructor already
+// requires a position, so args is used to resolve one the same way
+// funcHistogramQuantile and friends resolve theirs; the constructor's return
+// value is passed straight to notes.AddWarning since annoErr satisfies error.
+func histogramSchemaCompatNotes(points []HPoint, funcName, metricName string, args parser.Expressions) notes.Notes {
+	ns := notes.Notes{}
+	if len(points) < 2 {
+		return ns
+	}
+	pos := argPosition(args)
+	var mixedSchemaKinds, incompatibleBounds bool
+	first := points[0].H
+	for _, p := range points[1:] {
+		h := p.H
+		firstIsCustom := first.Schema == histogram.CustomBucketsSchema
+		if firstIsCustom != (h.Schema == histogram.CustomBucketsSchema) {
+			mixedSchemaKinds = true
+		} else if firstIsCustom && !customBucketBoundsEqual(first.CustomValues, h.CustomValues) {
+			incompatibleBounds = true
+		}
+	}
+	if mixedSchemaKinds {
+		ns.AddWarning(annotations.NewMixedExponentialCustomHistogramsWarning(funcName, metricName, pos))
+	}
+	if incompatibleBounds {
+		ns.AddWarning(annotations.NewIncompatibleCustomBucketsHistogramsWarning(metricName, pos))
+	}
+	return ns
+}
+
+// customBucketBoundsEqual reports whether two custom-bucket boundary slices
+// describe the same layout.
+func customBucketBoundsEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// argPosition resolves a position to attach to an annotation raised by a
+// function, from the expression of its first argument, the same one already
+// used for type assertions such as args[0].(*parser.MatrixSelector) above.
+func argPosition(args parser.Expressions) posrange.PositionRange {
+	if len(args) == 0 {
+		return posrange.PositionRange{}
+	}
+	return args[0].PositionRange()
+}
+
+// customBucketsInterpolationIsWide reports whether h uses custom buckets and
+// has at least one bucket wide enough, relative to h's overall value range,
+// that interpolating a quantile within it carries more uncertainty than
+// usual. This is a coarse approximation: it flags any bucket spanning more
+// than half of the histogram's total range, rather than only the bucket the
+// requested quantile actually falls in.
+func customBucketsInterpolationIsWide(h *histogram.FloatHistogram) bool {
+	if h.Schema != histogram.CustomBucketsSchema || len(h.CustomValues) < 2 {
+		return false
+	}
+	total := h.CustomValues[len(h.CustomValues)-1] - h.CustomValues[0]
+	if total <= 0 {
+		return false
+	}
+	for i := 1; i < len(h.CustomValues); i++ {
+		if (h.CustomValues[i]-h.CustomValues[i-1])/total > 0.5 {
+			return true
+		}
+	}
+	return false
+}
+
 // === avg_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes)  ===
 func funcAvgOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
-	if len(vals[0].(Matrix)[0].Floats) > 0 && len(vals[0].(Matrix)[0].Histograms) > 0 {
-		// TODO(zenador): Add warning for mixed floats and histograms.
-		return enh.Out, notes.Notes{}
+	el := vals[0].(Matrix)[0]
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
 	}
-	if len(vals[0].(Matrix)[0].Floats) == 0 {
+	if len(el.Floats) == 0 {
 		// The passed values only contain histograms.
+		ns := histogramSchemaCompatNotes(el.Histograms, "avg_over_time", el.Metric.Get(labels.MetricName), args)
 		return aggrHistOverTime(vals, enh, func(s Series) *histogram.FloatHistogram {
 			count := 1
 			mean := s.Histograms[0].H.Copy()
@@ -484,7 +715,7 @@ func funcAvgOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNode
 				}
 			}
 			return mean
-		}), notes.Notes{}
+		}), ns
 	}
 	return aggrOverTime(vals, enh, func(s Series) float64 {
 		var mean, count, c float64
@@ -550,14 +781,38 @@ func funcLastOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNod
 	}), notes.Notes{}
 }
 
+// histogramMeans reduces each histogram in s.Histograms to its Sum/Count, the
+// closest single-float proxy for "value" a native histogram has, so that
+// aggregators designed for floats (min/max/stddev/stdvar_over_time) can operate
+// on it the same way they do on classic samples.
+func histogramMeans(s Series) []float64 {
+	means := make([]float64, len(s.Histograms))
+	for i, h := range s.Histograms {
+		means[i] = h.H.Sum / h.H.Count
+	}
+	return means
+}
+
 // === max_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcMaxOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
-	if len(vals[0].(Matrix)[0].Floats) == 0 {
-		// TODO(beorn7): The passed values only contain
-		// histograms. max_over_time ignores histograms for now. If
-		// there are only histograms, we have to return without adding
-		// anything to enh.Out.
-		return enh.Out, notes.Notes{}
+	el := vals[0].(Matrix)[0]
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
+	}
+	if len(el.Floats) == 0 {
+		if len(el.Histograms) == 0 {
+			return enh.Out, notes.Notes{}
+		}
+		means := histogramMeans(el)
+		max := means[0]
+		for _, v := range means {
+			if v > max || math.IsNaN(max) {
+				max = v
+			}
+		}
+		return append(enh.Out, Sample{F: max}), notes.Notes{}
 	}
 	return aggrOverTime(vals, enh, func(s Series) float64 {
 		max := s.Floats[0].F
@@ -572,12 +827,24 @@ func funcMaxOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNode
 
 // === min_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcMinOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
-	if len(vals[0].(Matrix)[0].Floats) == 0 {
-		// TODO(beorn7): The passed values only contain
-		// histograms. min_over_time ignores histograms for now. If
-		// there are only histograms, we have to return without adding
-		// anything to enh.Out.
-		return enh.Out, notes.Notes{}
+	el := vals[0].(Matrix)[0]
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
+	}
+	if len(el.Floats) == 0 {
+		if len(el.Histograms) == 0 {
+			return enh.Out, notes.Notes{}
+		}
+		means := histogramMeans(el)
+		min := means[0]
+		for _, v := range means {
+			if v < min || math.IsNaN(min) {
+				min = v
+			}
+		}
+		return append(enh.Out, Sample{F: min}), notes.Notes{}
 	}
 	return aggrOverTime(vals, enh, func(s Series) float64 {
 		min := s.Floats[0].F
@@ -592,12 +859,15 @@ func funcMinOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNode
 
 // === sum_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcSumOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
-	if len(vals[0].(Matrix)[0].Floats) > 0 && len(vals[0].(Matrix)[0].Histograms) > 0 {
-		// TODO(zenador): Add warning for mixed floats and histograms.
-		return enh.Out, notes.Notes{}
+	el := vals[0].(Matrix)[0]
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
 	}
-	if len(vals[0].(Matrix)[0].Floats) == 0 {
+	if len(el.Floats) == 0 {
 		// The passed values only contain histograms.
+		ns := histogramSchemaCompatNotes(el.Histograms, "sum_over_time", el.Metric.Get(labels.MetricName), args)
 		return aggrHistOverTime(vals, enh, func(s Series) *histogram.FloatHistogram {
 			sum := s.Histograms[0].H.Copy()
 			for _, h := range s.Histograms[1:] {
@@ -610,7 +880,7 @@ func funcSumOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNode
 				}
 			}
 			return sum
-		}), notes.Notes{}
+		}), ns
 	}
 	return aggrOverTime(vals, enh, func(s Series) float64 {
 		var sum, c float64
@@ -628,12 +898,10 @@ func funcSumOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNode
 func funcQuantileOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
 	q := vals[0].(Vector)[0].F
 	el := vals[1].(Matrix)[0]
-	if len(el.Floats) == 0 {
-		// TODO(beorn7): The passed values only contain
-		// histograms. quantile_over_time ignores histograms for now. If
-		// there are only histograms, we have to return without adding
-		// anything to enh.Out.
-		return enh.Out, notes.Notes{}
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
 	}
 
 	ns := notes.Notes{}
@@ -641,6 +909,23 @@ func funcQuantileOverTime(vals []parser.Value, args parser.Expressions, enh *Eva
 		ns.AddWarning(notes.NewInvalidQuantileWarning(q))
 	}
 
+	if len(el.Floats) == 0 {
+		if len(el.Histograms) == 0 {
+			return enh.Out, ns
+		}
+		// Native histogram samples are cumulative snapshots, not per-interval
+		// deltas, so they cannot be summed across the window: doing so
+		// would inflate the bucket counts roughly
+		// N-fold for N overlapping snapshots. Instead compute the quantile of
+		// each snapshot individually and quantile those results, the same way
+		// the float branch below quantiles its individual samples.
+		histValues := make(vectorByValueHeap, 0, len(el.Histograms))
+		for _, h := range el.Histograms {
+			histValues = append(histValues, Sample{F: histogramQuantile(q, h.H)})
+		}
+		return append(enh.Out, Sample{F: quantile(q, histValues)}), ns
+	}
+
 	values := make(vectorByValueHeap, 0, len(el.Floats))
 	for _, f := range el.Floats {
 		values = append(values, Sample{F: f.F})
@@ -648,49 +933,102 @@ func funcQuantileOverTime(vals []parser.Value, args parser.Expressions, enh *Eva
 	return append(enh.Out, Sample{F: quantile(q, values)}), ns
 }
 
+// streamingStddevStdvar computes the standard deviation and variance of values
+// using Welford's online algorithm with Kahan-compensated running sums, the same
+// numerical approach stddev_over_time/stdvar_over_time already use for floats.
+func streamingStddevStdvar(values []float64) (stddev, stdvar float64) {
+	var count float64
+	var mean, cMean float64
+	var aux, cAux float64
+	for _, v := range values {
+		count++
+		delta := v - (mean + cMean)
+		mean, cMean = kahanSumInc(delta/count, mean, cMean)
+		aux, cAux = kahanSumInc(delta*(v-(mean+cMean)), aux, cAux)
+	}
+	stdvar = (aux + cAux) / count
+	return math.Sqrt(stdvar), stdvar
+}
+
 // === stddev_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcStddevOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
-	if len(vals[0].(Matrix)[0].Floats) == 0 {
-		// TODO(beorn7): The passed values only contain
-		// histograms. stddev_over_time ignores histograms for now. If
-		// there are only histograms, we have to return without adding
-		// anything to enh.Out.
-		return enh.Out, notes.Notes{}
+	el := vals[0].(Matrix)[0]
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
 	}
-	return aggrOverTime(vals, enh, func(s Series) float64 {
-		var count float64
-		var mean, cMean float64
-		var aux, cAux float64
-		for _, f := range s.Floats {
-			count++
-			delta := f.F - (mean + cMean)
-			mean, cMean = kahanSumInc(delta/count, mean, cMean)
-			aux, cAux = kahanSumInc(delta*(f.F-(mean+cMean)), aux, cAux)
+	if len(el.Floats) == 0 {
+		if len(el.Histograms) == 0 {
+			return enh.Out, notes.Notes{}
 		}
-		return math.Sqrt((aux + cAux) / count)
+		stddev, _ := streamingStddevStdvar(histogramMeans(el))
+		return append(enh.Out, Sample{F: stddev}), notes.Notes{}
+	}
+	return aggrOverTime(vals, enh, func(s Series) float64 {
+		stddev, _ := streamingStddevStdvar(floatValues(s.Floats))
+		return stddev
 	}), notes.Notes{}
 }
 
 // === stdvar_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcStdvarOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
-	if len(vals[0].(Matrix)[0].Floats) == 0 {
-		// TODO(beorn7): The passed values only contain
-		// histograms. stdvar_over_time ignores histograms for now. If
-		// there are only histograms, we have to return without adding
-		// anything to enh.Out.
-		return enh.Out, notes.Notes{}
+	el := vals[0].(Matrix)[0]
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
+	}
+	if len(el.Floats) == 0 {
+		if len(el.Histograms) == 0 {
+			return enh.Out, notes.Notes{}
+		}
+		_, stdvar := streamingStddevStdvar(histogramMeans(el))
+		return append(enh.Out, Sample{F: stdvar}), notes.Notes{}
 	}
 	return aggrOverTime(vals, enh, func(s Series) float64 {
-		var count float64
-		var mean, cMean float64
-		var aux, cAux float64
+		_, stdvar := streamingStddevStdvar(floatValues(s.Floats))
+		return stdvar
+	}), notes.Notes{}
+}
+
+// floatValues extracts the sample values from points, for callers that want to
+// run a values-only aggregator such as streamingStddevStdvar over a Series.
+func floatValues(points []FPoint) []float64 {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.F
+	}
+	return values
+}
+
+// === mad_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
+func funcMadOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	el := vals[0].(Matrix)[0]
+	if len(el.Floats) > 0 && len(el.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(el.Metric.Get(labels.MetricName), len(el.Floats), len(el.Histograms)))
+		return enh.Out, ns
+	}
+	if len(el.Floats) == 0 {
+		ns := notes.Notes{}
+		if len(el.Histograms) > 0 {
+			ns.AddInfo(notes.NewHistogramsIgnoredInfo("mad_over_time", el.Metric.Get(labels.MetricName)))
+		}
+		return enh.Out, ns
+	}
+	return aggrOverTime(vals, enh, func(s Series) float64 {
+		values := make(vectorByValueHeap, 0, len(s.Floats))
 		for _, f := range s.Floats {
-			count++
-			delta := f.F - (mean + cMean)
-			mean, cMean = kahanSumInc(delta/count, mean, cMean)
-			aux, cAux = kahanSumInc(delta*(f.F-(mean+cMean)), aux, cAux)
+			values = append(values, Sample{F: f.F})
+		}
+		median := quantile(0.5, values)
+
+		deviations := make(vectorByValueHeap, 0, len(s.Floats))
+		for _, f := range s.Floats {
+			deviations = append(deviations, Sample{F: math.Abs(f.F - median)})
 		}
-		return (aux + cAux) / count
+		return quantile(0.5, deviations)
 	}), notes.Notes{}
 }
 
@@ -945,14 +1283,78 @@ func linearRegression(samples []FPoint, interceptTime int64) (slope, intercept f
 	return slope, intercept
 }
 
+// histogramLinearRegression is the histogram analogue of linearRegression: it
+// performs the same least-squares regression, but once for every bucket
+// (plus Count and Sum) at the same time by taking the weighted sum of the
+// input histograms, the weight for point i being the same scalar
+// (x_i-meanX)/varX that linearRegression would multiply that point's y value
+// by. Histograms are aligned to the coarsest (smallest) schema among points
+// first; buckets absent after alignment are treated as zero, which is exactly
+// what Add does for sparse native histogram buckets.
+func histogramLinearRegression(points []HPoint, interceptTime int64) (slope, intercept *histogram.FloatHistogram) {
+	minSchema := points[0].H.Schema
+	for _, p := range points[1:] {
+		if p.H.Schema < minSchema {
+			minSchema = p.H.Schema
+		}
+	}
+
+	n := float64(len(points))
+	xs := make([]float64, len(points))
+	var sumX float64
+	for i, p := range points {
+		xs[i] = float64(p.T-interceptTime) / 1e3
+		sumX += xs[i]
+	}
+	meanX := sumX / n
+
+	var varX float64
+	for _, x := range xs {
+		d := x - meanX
+		varX += d * d
+	}
+
+	mean := points[0].H.CopyToSchema(minSchema).Div(n)
+	for _, p := range points[1:] {
+		mean = mean.Add(p.H.CopyToSchema(minSchema).Div(n))
+	}
+
+	if varX == 0 {
+		// All points share the same x (or there's only one); there is no
+		// well-defined slope, so report a flat line through the mean.
+		flat := points[0].H.CopyToSchema(minSchema).Mul(0)
+		flat.CounterResetHint = histogram.GaugeType
+		mean.CounterResetHint = histogram.GaugeType
+		return flat, mean
+	}
+
+	slope = points[0].H.CopyToSchema(minSchema).Mul(xs[0] / varX)
+	for i, p := range points[1:] {
+		slope = slope.Add(p.H.CopyToSchema(minSchema).Mul(xs[i+1] / varX))
+	}
+	slope = slope.Add(mean.Copy().Mul(-meanX * n / varX))
+
+	intercept = mean.Copy().Add(slope.Copy().Mul(-meanX))
+	slope.CounterResetHint = histogram.GaugeType
+	intercept.CounterResetHint = histogram.GaugeType
+	return slope, intercept
+}
+
 // === deriv(node parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcDeriv(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
 	samples := vals[0].(Matrix)[0]
 
-	// No sense in trying to compute a derivative without at least two points.
-	// Drop this Vector element.
 	if len(samples.Floats) < 2 {
-		return enh.Out, notes.Notes{}
+		if len(samples.Histograms) < 2 {
+			// No sense in trying to compute a derivative without at least
+			// two points. Drop this Vector element.
+			return enh.Out, notes.Notes{}
+		}
+		// We pass in an arbitrary timestamp that is near the values in use
+		// to avoid floating point accuracy issues, see
+		// https://github.com/prometheus/prometheus/issues/2674
+		slope, _ := histogramLinearRegression(samples.Histograms, samples.Histograms[0].T)
+		return append(enh.Out, Sample{H: slope}), notes.Notes{}
 	}
 
 	// We pass in an arbitrary timestamp that is near the values in use
@@ -966,14 +1368,85 @@ func funcDeriv(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper
 func funcPredictLinear(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
 	samples := vals[0].(Matrix)[0]
 	duration := vals[1].(Vector)[0].F
+
+	if len(samples.Floats) < 2 {
+		if len(samples.Histograms) < 2 {
+			// No sense in trying to predict anything without at least two
+			// points. Drop this Vector element.
+			return enh.Out, notes.Notes{}
+		}
+		slope, intercept := histogramLinearRegression(samples.Histograms, enh.Ts)
+		result := slope.Copy().Mul(duration).Add(intercept)
+		result.CounterResetHint = histogram.GaugeType
+		return append(enh.Out, Sample{H: result}), notes.Notes{}
+	}
+	slope, intercept := linearRegression(samples.Floats, enh.Ts)
+
+	return append(enh.Out, Sample{F: slope*duration + intercept}), notes.Notes{}
+}
+
+// === linear_regression_over_time(Matrix parser.ValueTypeMatrix, offset_seconds=0 Scalar) (Vector, Notes) ===
+func funcLinearRegressionOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	samples := vals[0].(Matrix)[0]
+	var offsetSeconds float64
+	if len(args) >= 2 {
+		offsetSeconds = vals[1].(Vector)[0].F
+	}
+	if len(samples.Floats) > 0 && len(samples.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(samples.Metric.Get(labels.MetricName), len(samples.Floats), len(samples.Histograms)))
+		return enh.Out, ns
+	}
 	// No sense in trying to predict anything without at least two points.
 	// Drop this Vector element.
 	if len(samples.Floats) < 2 {
-		return enh.Out, notes.Notes{}
+		ns := notes.Notes{}
+		if len(samples.Histograms) > 0 {
+			ns.AddInfo(notes.NewHistogramsIgnoredInfo("linear_regression_over_time", samples.Metric.Get(labels.MetricName)))
+		}
+		return enh.Out, ns
 	}
 	slope, intercept := linearRegression(samples.Floats, enh.Ts)
 
-	return append(enh.Out, Sample{F: slope*duration + intercept}), notes.Notes{}
+	return append(enh.Out, Sample{F: slope*offsetSeconds + intercept}), notes.Notes{}
+}
+
+// === slope_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
+func funcSlopeOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	samples := vals[0].(Matrix)[0]
+	if len(samples.Floats) > 0 && len(samples.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(samples.Metric.Get(labels.MetricName), len(samples.Floats), len(samples.Histograms)))
+		return enh.Out, ns
+	}
+	if len(samples.Floats) < 2 {
+		ns := notes.Notes{}
+		if len(samples.Histograms) > 0 {
+			ns.AddInfo(notes.NewHistogramsIgnoredInfo("slope_over_time", samples.Metric.Get(labels.MetricName)))
+		}
+		return enh.Out, ns
+	}
+	slope, _ := linearRegression(samples.Floats, samples.Floats[0].T)
+	return append(enh.Out, Sample{F: slope}), notes.Notes{}
+}
+
+// === intercept_over_time(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
+func funcInterceptOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	samples := vals[0].(Matrix)[0]
+	if len(samples.Floats) > 0 && len(samples.Histograms) > 0 {
+		ns := notes.Notes{}
+		ns.AddInfo(notes.NewMixedTypesDroppedInfo(samples.Metric.Get(labels.MetricName), len(samples.Floats), len(samples.Histograms)))
+		return enh.Out, ns
+	}
+	if len(samples.Floats) < 2 {
+		ns := notes.Notes{}
+		if len(samples.Histograms) > 0 {
+			ns.AddInfo(notes.NewHistogramsIgnoredInfo("intercept_over_time", samples.Metric.Get(labels.MetricName)))
+		}
+		return enh.Out, ns
+	}
+	_, intercept := linearRegression(samples.Floats, samples.Floats[0].T)
+	return append(enh.Out, Sample{F: intercept}), notes.Notes{}
 }
 
 // === histogram_count(Vector parser.ValueTypeVector) (Vector, Notes) ===
@@ -1010,6 +1483,147 @@ func funcHistogramSum(vals []parser.Value, args parser.Expressions, enh *EvalNod
 	return enh.Out, notes.Notes{}
 }
 
+// === histogram_avg(Vector parser.ValueTypeVector) (Vector, Notes) ===
+func funcHistogramAvg(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	inVec := vals[0].(Vector)
+
+	for _, sample := range inVec {
+		// Skip non-histogram samples.
+		if sample.H == nil {
+			continue
+		}
+		enh.Out = append(enh.Out, Sample{
+			Metric: enh.DropMetricName(sample.Metric),
+			F:      sample.H.Sum / sample.H.Count,
+		})
+	}
+	return enh.Out, notes.Notes{}
+}
+
+// formatBucketBound formats a native histogram bucket boundary the way
+// classic histograms label their buckets, so output of histogram_buckets can
+// be consumed by tooling built for the `le` label (e.g. histogram_quantile).
+func formatBucketBound(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	if math.IsInf(v, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// === histogram_buckets(Vector parser.ValueTypeVector) (Vector, Notes) ===
+func funcHistogramBuckets(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	inVec := vals[0].(Vector)
+
+	for _, sample := range inVec {
+		// Skip non-histogram samples.
+		if sample.H == nil {
+			continue
+		}
+		baseLabels := enh.DropMetricName(sample.Metric)
+
+		var count float64
+		lastUpper := math.Inf(-1)
+		it := sample.H.AllBucketIterator()
+		for it.Next() {
+			bucket := it.At()
+			count += bucket.Count
+			lastUpper = bucket.Upper
+			enh.Out = append(enh.Out, Sample{
+				Metric: labels.NewBuilder(baseLabels).
+					Set(model.BucketLabel, formatBucketBound(bucket.Upper)).
+					Set("ge", formatBucketBound(bucket.Lower)).
+					Labels(),
+				F: count,
+			})
+		}
+		// Exponential-schema histograms have no overflow bucket, so every
+		// bucket above has a finite Upper. A custom-bucket histogram can end
+		// in an overflow bucket whose Upper is +Inf; if the loop above emitted
+		// it, that bucket already carries le="+Inf" and the running total.
+		// Otherwise synthesize the classic-histogram le="+Inf" bucket so
+		// downstream queries that filter on it (the standard idiom this
+		// function exists to support) get the running total.
+		if !math.IsInf(lastUpper, 1) {
+			enh.Out = append(enh.Out, Sample{
+				Metric: labels.NewBuilder(baseLabels).
+					Set(model.BucketLabel, formatBucketBound(math.Inf(1))).
+					Set("ge", formatBucketBound(math.Inf(-1))).
+					Labels(),
+				F: count,
+			})
+		}
+	}
+	return enh.Out, notes.Notes{}
+}
+
+// === histogram_min(Vector parser.ValueTypeVector) (Vector, Notes) ===
+func funcHistogramMin(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	inVec := vals[0].(Vector)
+
+	for _, sample := range inVec {
+		// Skip non-histogram samples.
+		if sample.H == nil {
+			continue
+		}
+		min := math.Inf(1)
+		it := sample.H.AllBucketIterator()
+		for it.Next() {
+			bucket := it.At()
+			// Only buckets with at least one observation define the
+			// populated range; this also takes care of the zero bucket and
+			// negative buckets, whose Lower/Upper already span correctly.
+			if bucket.Count == 0 {
+				continue
+			}
+			if bucket.Lower < min {
+				min = bucket.Lower
+			}
+		}
+		if math.IsInf(min, 1) {
+			min = 0
+		}
+		enh.Out = append(enh.Out, Sample{
+			Metric: enh.DropMetricName(sample.Metric),
+			F:      min,
+		})
+	}
+	return enh.Out, notes.Notes{}
+}
+
+// === histogram_max(Vector parser.ValueTypeVector) (Vector, Notes) ===
+func funcHistogramMax(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
+	inVec := vals[0].(Vector)
+
+	for _, sample := range inVec {
+		// Skip non-histogram samples.
+		if sample.H == nil {
+			continue
+		}
+		max := math.Inf(-1)
+		it := sample.H.AllBucketIterator()
+		for it.Next() {
+			bucket := it.At()
+			if bucket.Count == 0 {
+				continue
+			}
+			if bucket.Upper > max {
+				max = bucket.Upper
+			}
+		}
+		if math.IsInf(max, -1) {
+			max = 0
+		}
+		enh.Out = append(enh.Out, Sample{
+			Metric: enh.DropMetricName(sample.Metric),
+			F:      max,
+		})
+	}
+	return enh.Out, notes.Notes{}
+}
+
 // === histogram_stddev(Vector parser.ValueTypeVector) (Vector, Notes)  ===
 func funcHistogramStdDev(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, Notes) {
 	inVec := vals[0].(Vector)
@@ -1158,6 +1772,10 @@ func funcHistogramQuantile(vals []parser.Value, args parser.Expressions, enh *Ev
 			continue
 		}
 
+		if customBucketsInterpolationIsWide(sample.H) {
+			ns.AddInfo(annotations.NewCustomBucketsQuantileInterpolationInfo(sample.Metric.Get(labels.MetricName), argPosition(args)))
+		}
+
 		enh.Out = append(enh.Out, Sample{
 			Metric: enh.DropMetricName(sample.Metric),
 			F:      histogramQuantile(q, sample.H),
@@ -1176,31 +1794,74 @@ func funcHistogramQuantile(vals []parser.Value, args parser.Expressions, enh *Ev
 	return enh.Out, ns
 }
 
+// floatOrHistogramPoint is a single point of a timeline that interleaves
+// float and histogram samples, as produced by mergeFloatsAndHistograms. H is
+// nil for a float point.
+type floatOrHistogramPoint struct {
+	T int64
+	F float64
+	H *histogram.FloatHistogram
+}
+
+// mergeFloatsAndHistograms merges floats and histograms, both assumed sorted
+// by timestamp, into a single chronological timeline. This lets resets/changes
+// reason about a series that switches between float and native-histogram
+// samples over its range, which neither input alone can represent.
+func mergeFloatsAndHistograms(floats []FPoint, histograms []HPoint) []floatOrHistogramPoint {
+	merged := make([]floatOrHistogramPoint, 0, len(floats)+len(histograms))
+	i, j := 0, 0
+	for i < len(floats) || j < len(histograms) {
+		if j >= len(histograms) || (i < len(floats) && floats[i].T <= histograms[j].T) {
+			merged = append(merged, floatOrHistogramPoint{T: floats[i].T, F: floats[i].F})
+			i++
+		} else {
+			merged = append(merged, floatOrHistogramPoint{T: histograms[j].T, H: histograms[j].H})
+			j++
+		}
+	}
+	return merged
+}
+
+// histogramsChanged reports whether b differs from a in schema, count, sum,
+// or any individual bucket.
+func histogramsChanged(a, b *histogram.FloatHistogram) bool {
+	if a.Schema != b.Schema || a.Count != b.Count || a.Sum != b.Sum {
+		return true
+	}
+	itA, itB := a.AllBucketIterator(), b.AllBucketIterator()
+	for itA.Next() {
+		if !itB.Next() {
+			return true
+		}
+		bucketA, bucketB := itA.At(), itB.At()
+		if bucketA.Count != bucketB.Count || bucketA.Lower != bucketB.Lower || bucketA.Upper != bucketB.Upper {
+			return true
+		}
+	}
+	return itB.Next()
+}
+
 // === resets(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcResets(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
 	floats := vals[0].(Matrix)[0].Floats
 	histograms := vals[0].(Matrix)[0].Histograms
 	resets := 0
 
-	if len(floats) > 1 {
-		prev := floats[0].F
-		for _, sample := range floats[1:] {
-			current := sample.F
-			if current < prev {
+	points := mergeFloatsAndHistograms(floats, histograms)
+	for i := 1; i < len(points); i++ {
+		prev, curr := points[i-1], points[i]
+		switch {
+		case prev.H == nil && curr.H == nil:
+			if curr.F < prev.F {
 				resets++
 			}
-			prev = current
-		}
-	}
-
-	if len(histograms) > 1 {
-		prev := histograms[0].H
-		for _, sample := range histograms[1:] {
-			current := sample.H
-			if current.DetectReset(prev) {
+		case prev.H != nil && curr.H != nil:
+			if curr.H.DetectReset(prev.H) {
 				resets++
 			}
-			prev = current
+		default:
+			// A flip between float and histogram counts as a reset.
+			resets++
 		}
 	}
 
@@ -1210,20 +1871,29 @@ func funcResets(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelpe
 // === changes(Matrix parser.ValueTypeMatrix) (Vector, Notes) ===
 func funcChanges(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) (Vector, notes.Notes) {
 	floats := vals[0].(Matrix)[0].Floats
+	histograms := vals[0].(Matrix)[0].Histograms
 	changes := 0
 
-	if len(floats) == 0 {
-		// TODO(beorn7): Only histogram values, still need to add support.
+	points := mergeFloatsAndHistograms(floats, histograms)
+	if len(points) == 0 {
 		return enh.Out, notes.Notes{}
 	}
 
-	prev := floats[0].F
-	for _, sample := range floats[1:] {
-		current := sample.F
-		if current != prev && !(math.IsNaN(current) && math.IsNaN(prev)) {
+	for i := 1; i < len(points); i++ {
+		prev, curr := points[i-1], points[i]
+		switch {
+		case prev.H == nil && curr.H == nil:
+			if curr.F != prev.F && !(math.IsNaN(curr.F) && math.IsNaN(prev.F)) {
+				changes++
+			}
+		case prev.H != nil && curr.H != nil:
+			if histogramsChanged(prev.H, curr.H) {
+				changes++
+			}
+		default:
+			// A flip between float and histogram counts as a change.
 			changes++
 		}
-		prev = current
 	}
 
 	return append(enh.Out, Sample{F: float64(changes)}), notes.Notes{}
@@ -1430,78 +2100,89 @@ func funcYear(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper)
 
 // FunctionCalls is a list of all functions supported by PromQL, including their types.
 var FunctionCalls = map[string]FunctionCall{
-	"abs":                funcAbs,
-	"absent":             funcAbsent,
-	"absent_over_time":   funcAbsentOverTime,
-	"acos":               funcAcos,
-	"acosh":              funcAcosh,
-	"asin":               funcAsin,
-	"asinh":              funcAsinh,
-	"atan":               funcAtan,
-	"atanh":              funcAtanh,
-	"avg_over_time":      funcAvgOverTime,
-	"ceil":               funcCeil,
-	"changes":            funcChanges,
-	"clamp":              funcClamp,
-	"clamp_max":          funcClampMax,
-	"clamp_min":          funcClampMin,
-	"cos":                funcCos,
-	"cosh":               funcCosh,
-	"count_over_time":    funcCountOverTime,
-	"days_in_month":      funcDaysInMonth,
-	"day_of_month":       funcDayOfMonth,
-	"day_of_week":        funcDayOfWeek,
-	"day_of_year":        funcDayOfYear,
-	"deg":                funcDeg,
-	"delta":              funcDelta,
-	"deriv":              funcDeriv,
-	"exp":                funcExp,
-	"floor":              funcFloor,
-	"histogram_count":    funcHistogramCount,
-	"histogram_fraction": funcHistogramFraction,
-	"histogram_quantile": funcHistogramQuantile,
-	"histogram_sum":      funcHistogramSum,
-	"histogram_stddev":   funcHistogramStdDev,
-	"histogram_stdvar":   funcHistogramStdVar,
-	"holt_winters":       funcHoltWinters,
-	"hour":               funcHour,
-	"idelta":             funcIdelta,
-	"increase":           funcIncrease,
-	"irate":              funcIrate,
-	"label_replace":      funcLabelReplace,
-	"label_join":         funcLabelJoin,
-	"ln":                 funcLn,
-	"log10":              funcLog10,
-	"log2":               funcLog2,
-	"last_over_time":     funcLastOverTime,
-	"max_over_time":      funcMaxOverTime,
-	"min_over_time":      funcMinOverTime,
-	"minute":             funcMinute,
-	"month":              funcMonth,
-	"pi":                 funcPi,
-	"predict_linear":     funcPredictLinear,
-	"present_over_time":  funcPresentOverTime,
-	"quantile_over_time": funcQuantileOverTime,
-	"rad":                funcRad,
-	"rate":               funcRate,
-	"resets":             funcResets,
-	"round":              funcRound,
-	"scalar":             funcScalar,
-	"sgn":                funcSgn,
-	"sin":                funcSin,
-	"sinh":               funcSinh,
-	"sort":               funcSort,
-	"sort_desc":          funcSortDesc,
-	"sqrt":               funcSqrt,
-	"stddev_over_time":   funcStddevOverTime,
-	"stdvar_over_time":   funcStdvarOverTime,
-	"sum_over_time":      funcSumOverTime,
-	"tan":                funcTan,
-	"tanh":               funcTanh,
-	"time":               funcTime,
-	"timestamp":          funcTimestamp,
-	"vector":             funcVector,
-	"year":               funcYear,
+	"abs":                         funcAbs,
+	"absent":                      funcAbsent,
+	"absent_over_time":            funcAbsentOverTime,
+	"acos":                        funcAcos,
+	"acosh":                       funcAcosh,
+	"asin":                        funcAsin,
+	"asinh":                       funcAsinh,
+	"atan":                        funcAtan,
+	"atanh":                       funcAtanh,
+	"avg_over_time":               funcAvgOverTime,
+	"ceil":                        funcCeil,
+	"changes":                     funcChanges,
+	"clamp":                       funcClamp,
+	"clamp_max":                   funcClampMax,
+	"clamp_min":                   funcClampMin,
+	"cos":                         funcCos,
+	"cosh":                        funcCosh,
+	"count_over_time":             funcCountOverTime,
+	"days_in_month":               funcDaysInMonth,
+	"day_of_month":                funcDayOfMonth,
+	"day_of_week":                 funcDayOfWeek,
+	"day_of_year":                 funcDayOfYear,
+	"deg":                         funcDeg,
+	"delta":                       funcDelta,
+	"deriv":                       funcDeriv,
+	"exp":                         funcExp,
+	"floor":                       funcFloor,
+	"histogram_avg":               funcHistogramAvg,
+	"histogram_buckets":           funcHistogramBuckets,
+	"histogram_count":             funcHistogramCount,
+	"histogram_fraction":          funcHistogramFraction,
+	"histogram_max":               funcHistogramMax,
+	"histogram_min":               funcHistogramMin,
+	"histogram_quantile":          funcHistogramQuantile,
+	"histogram_sum":               funcHistogramSum,
+	"histogram_stddev":            funcHistogramStdDev,
+	"histogram_stdvar":            funcHistogramStdVar,
+	"holt_winters":                funcHoltWinters,
+	"holt_winters_seasonal":       funcHoltWintersSeasonal,
+	"hour":                        funcHour,
+	"idelta":                      funcIdelta,
+	"increase":                    funcIncrease,
+	"intercept_over_time":         funcInterceptOverTime,
+	"irate":                       funcIrate,
+	"label_replace":               funcLabelReplace,
+	"label_join":                  funcLabelJoin,
+	"linear_regression_over_time": funcLinearRegressionOverTime,
+	"ln":                          funcLn,
+	"log10":                       funcLog10,
+	"log2":                        funcLog2,
+	"last_over_time":              funcLastOverTime,
+	"mad_over_time":               funcMadOverTime,
+	"max_over_time":               funcMaxOverTime,
+	"min_over_time":               funcMinOverTime,
+	"minute":                      funcMinute,
+	"month":                       funcMonth,
+	"pi":                          funcPi,
+	"predict_linear":              funcPredictLinear,
+	"present_over_time":           funcPresentOverTime,
+	"quantile_over_time":          funcQuantileOverTime,
+	"slope_over_time":             funcSlopeOverTime,
+	"rad":                         funcRad,
+	"rate":                        funcRate,
+	"resets":                      funcResets,
+	"round":                       funcRound,
+	"scalar":                      funcScalar,
+	"sgn":                         funcSgn,
+	"sin":                         funcSin,
+	"sinh":                        funcSinh,
+	"sort":                        funcSort,
+	"sort_by_label":               funcSortByLabel,
+	"sort_by_label_desc":          funcSortByLabelDesc,
+	"sort_desc":                   funcSortDesc,
+	"sqrt":                        funcSqrt,
+	"stddev_over_time":            funcStddevOverTime,
+	"stdvar_over_time":            funcStdvarOverTime,
+	"sum_over_time":               funcSumOverTime,
+	"tan":                         funcTan,
+	"tanh":                        funcTanh,
+	"time":                        funcTime,
+	"timestamp":                   funcTimestamp,
+	"vector":                      funcVector,
+	"year":                        funcYear,
 }
 
 // AtModifierUnsafeFunctions are the functions whose result
@@ -1513,12 +2194,79 @@ var AtModifierUnsafeFunctions = map[string]struct{}{
 	// Step invariant functions.
 	"days_in_month": {}, "day_of_month": {}, "day_of_week": {}, "day_of_year": {},
 	"hour": {}, "minute": {}, "month": {}, "year": {},
-	"predict_linear": {}, "time": {},
+	"predict_linear": {}, "linear_regression_over_time": {}, "time": {},
 	// Uses timestamp of the argument for the result,
 	// hence unsafe to use with @ modifier.
 	"timestamp": {},
 }
 
+// RegisterOption configures a function registered via RegisterFunction.
+type RegisterOption func(*registration)
+
+type registration struct {
+	atModifierUnsafe bool
+}
+
+// WithAtModifierUnsafe marks the function being registered as unsafe to use
+// with the @ modifier when its arguments are step invariant, e.g. because its
+// result depends on the evaluation timestamp rather than purely on its
+// arguments. It populates AtModifierUnsafeFunctions the same way the builtins
+// above do.
+func WithAtModifierUnsafe() RegisterOption {
+	return func(r *registration) {
+		r.atModifierUnsafe = true
+	}
+}
+
+// registerFunctionMu guards FunctionCalls, parser.Functions, and
+// AtModifierUnsafeFunctions against concurrent RegisterFunction calls. It
+// does not make registration safe to interleave with query evaluation: these
+// maps are shared package-level state with no per-engine isolation, so
+// RegisterFunction is expected to be called at init time, before any engine
+// built on this package starts evaluating queries. A per-engine function
+// registry that EngineOpts could carry would remove that restriction, but
+// that is a larger change than this mutex.
+var registerFunctionMu sync.Mutex
+
+// RegisterFunction adds a custom PromQL function to the engine, so that
+// domain-specific aggregations can be added without forking this package. f
+// describes the function's name and signature to the parser; call is the
+// evaluator invoked at query time. It is an error to register a name that
+// collides with a builtin or a function registered earlier.
+//
+// RegisterFunction must be called at init time, before any query evaluation
+// begins: it mutates process-wide state shared by every engine instance, and
+// does not guard against readers of that state, only against other
+// concurrent registrations.
+func RegisterFunction(f *parser.Function, call FunctionCall, opts ...RegisterOption) error {
+	if f == nil || f.Name == "" {
+		return fmt.Errorf("promql: cannot register a function with no name")
+	}
+	name := f.Name
+
+	registerFunctionMu.Lock()
+	defer registerFunctionMu.Unlock()
+
+	if _, ok := FunctionCalls[name]; ok {
+		return fmt.Errorf("promql: function %q is already registered", name)
+	}
+	if _, ok := parser.Functions[name]; ok {
+		return fmt.Errorf("promql: function %q is already known to the parser", name)
+	}
+
+	var reg registration
+	for _, opt := range opts {
+		opt(&reg)
+	}
+
+	parser.Functions[name] = f
+	FunctionCalls[name] = call
+	if reg.atModifierUnsafe {
+		AtModifierUnsafeFunctions[name] = struct{}{}
+	}
+	return nil
+}
+
 type vectorByValueHeap Vector
 
 func (s vectorByValueHeap) Len() int {
@@ -1597,6 +2345,60 @@ func (s *vectorByReverseValueHeap) Pop() interface{} {
 	return el
 }
 
+// vectorByLabelHeap sorts a Vector lexicographically by the concatenation of
+// the named labels' values, falling back to the sample value (as
+// vectorByValueHeap does) to break ties between series that share those
+// label values.
+type vectorByLabelHeap struct {
+	vector Vector
+	labels []string
+}
+
+func (s vectorByLabelHeap) Len() int {
+	return len(s.vector)
+}
+
+func (s vectorByLabelHeap) Less(i, j int) bool {
+	var lv, rv string
+	for _, name := range s.labels {
+		lv += s.vector[i].Metric.Get(name)
+		rv += s.vector[j].Metric.Get(name)
+	}
+	if lv != rv {
+		return lv < rv
+	}
+
+	// We compare histograms based on their sum of observations.
+	vi, vj := s.vector[i].F, s.vector[j].F
+	if s.vector[i].H != nil {
+		vi = s.vector[i].H.Sum
+	}
+	if s.vector[j].H != nil {
+		vj = s.vector[j].H.Sum
+	}
+
+	if math.IsNaN(vi) {
+		return true
+	}
+	return vi < vj
+}
+
+func (s vectorByLabelHeap) Swap(i, j int) {
+	s.vector[i], s.vector[j] = s.vector[j], s.vector[i]
+}
+
+func (s *vectorByLabelHeap) Push(x interface{}) {
+	s.vector = append(s.vector, *(x.(*Sample)))
+}
+
+func (s *vectorByLabelHeap) Pop() interface{} {
+	old := s.vector
+	n := len(old)
+	el := old[n-1]
+	s.vector = old[0 : n-1]
+	return el
+}
+
 // createLabelsForAbsentFunction returns the labels that are uniquely and exactly matched
 // in a given expression. It is used in the absent functions.
 func createLabelsForAbsentFunction(expr parser.Expr) labels.Labels {
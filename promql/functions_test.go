@@ -0,0 +1,305 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promql
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/util/notes"
+)
+
+func TestMergeFloatsAndHistograms(t *testing.T) {
+	h1 := &histogram.FloatHistogram{Count: 1, Sum: 1}
+	h2 := &histogram.FloatHistogram{Count: 2, Sum: 2}
+
+	floats := []FPoint{{T: 10, F: 1}, {T: 30, F: 3}, {T: 50, F: 5}}
+	histograms := []HPoint{{T: 20, H: h1}, {T: 40, H: h2}}
+
+	merged := mergeFloatsAndHistograms(floats, histograms)
+	require.Len(t, merged, 5)
+
+	wantT := []int64{10, 20, 30, 40, 50}
+	for i, p := range merged {
+		require.Equal(t, wantT[i], p.T)
+	}
+	require.Nil(t, merged[0].H)
+	require.Same(t, h1, merged[1].H)
+	require.Nil(t, merged[2].H)
+	require.Same(t, h2, merged[3].H)
+	require.Nil(t, merged[4].H)
+}
+
+func TestHistogramsChanged(t *testing.T) {
+	base := &histogram.FloatHistogram{
+		Schema:          0,
+		Count:           4,
+		Sum:             10,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}},
+		PositiveBuckets: []float64{1, 3},
+	}
+
+	t.Run("identical", func(t *testing.T) {
+		other := base.Copy()
+		require.False(t, histogramsChanged(base, other))
+	})
+
+	t.Run("different sum", func(t *testing.T) {
+		other := base.Copy()
+		other.Sum = 11
+		require.True(t, histogramsChanged(base, other))
+	})
+
+	t.Run("different bucket counts", func(t *testing.T) {
+		other := base.Copy()
+		other.PositiveBuckets = []float64{2, 2}
+		require.True(t, histogramsChanged(base, other))
+	})
+
+	t.Run("different schema", func(t *testing.T) {
+		other := base.Copy()
+		other.Schema = 1
+		require.True(t, histogramsChanged(base, other))
+	})
+}
+
+func TestResetsChangesInterleaved(t *testing.T) {
+	metric := labels.FromStrings(labels.MetricName, "requests_total")
+
+	histA := &histogram.FloatHistogram{Count: 4, Sum: 10}
+	histB := &histogram.FloatHistogram{Count: 4, Sum: 10} // identical to histA
+	histC := &histogram.FloatHistogram{Count: 1, Sum: 2}  // counter reset relative to histB
+
+	// Chronological order: float 5, float 8, histA, histB (unchanged), histC
+	// (reset), float 3, float 3 (unchanged). This interleaves float and
+	// histogram samples rather than exercising mergeFloatsAndHistograms or
+	// histogramsChanged in isolation.
+	floats := []FPoint{{T: 0, F: 5}, {T: 10, F: 8}, {T: 40, F: 3}, {T: 50, F: 3}}
+	histograms := []HPoint{{T: 20, H: histA}, {T: 30, H: histB}, {T: 35, H: histC}}
+	matrix := Matrix{Series{Metric: metric, Floats: floats, Histograms: histograms}}
+
+	t.Run("resets", func(t *testing.T) {
+		out, ns := funcResets([]parser.Value{matrix}, nil, &EvalNodeHelper{})
+		require.Empty(t, ns.Warnings)
+		require.Len(t, out, 1)
+		// float->hist, histB->histC (counter reset), hist->float: 3 resets.
+		// float->float (5->8) and histA->histB (unchanged) are not resets.
+		require.Equal(t, 3.0, out[0].F)
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		out, ns := funcChanges([]parser.Value{matrix}, nil, &EvalNodeHelper{})
+		require.Empty(t, ns.Warnings)
+		require.Len(t, out, 1)
+		// Every transition changes except histA->histB (identical) and the
+		// final float 3->3.
+		require.Equal(t, 4.0, out[0].F)
+	})
+}
+
+func TestHistogramMinMaxAvg(t *testing.T) {
+	metric := labels.FromStrings(labels.MetricName, "http_request_duration_seconds")
+
+	// A histogram with only its zero bucket populated: AllBucketIterator
+	// reports it spanning [-ZeroThreshold, +ZeroThreshold] regardless of
+	// whether the schema is the integer (classic-compatible) or a finer
+	// float-style resolution, so min/max don't depend on bucket schema at all.
+	newZeroBucketHistogram := func(schema int32) *histogram.FloatHistogram {
+		return &histogram.FloatHistogram{
+			Schema:        schema,
+			ZeroThreshold: 0.001,
+			ZeroCount:     5,
+			Count:         5,
+			Sum:           0.002,
+		}
+	}
+
+	for name, schema := range map[string]int32{"integer schema": 0, "float (finer) schema": 3} {
+		t.Run(name, func(t *testing.T) {
+			h := newZeroBucketHistogram(schema)
+			inVec := Vector{{Metric: metric, H: h}}
+
+			minOut, _ := funcHistogramMin([]parser.Value{inVec}, nil, &EvalNodeHelper{})
+			require.Len(t, minOut, 1)
+			require.Equal(t, -0.001, minOut[0].F)
+
+			maxOut, _ := funcHistogramMax([]parser.Value{inVec}, nil, &EvalNodeHelper{})
+			require.Len(t, maxOut, 1)
+			require.Equal(t, 0.001, maxOut[0].F)
+
+			avgOut, _ := funcHistogramAvg([]parser.Value{inVec}, nil, &EvalNodeHelper{})
+			require.Len(t, avgOut, 1)
+			require.Equal(t, h.Sum/h.Count, avgOut[0].F)
+		})
+	}
+
+	t.Run("mixed vector skips the float-only sample", func(t *testing.T) {
+		h := newZeroBucketHistogram(0)
+		inVec := Vector{
+			{Metric: metric, F: 3.5},
+			{Metric: metric, H: h},
+		}
+
+		minOut, _ := funcHistogramMin([]parser.Value{inVec}, nil, &EvalNodeHelper{})
+		require.Len(t, minOut, 1)
+		require.Equal(t, -0.001, minOut[0].F)
+
+		avgOut, _ := funcHistogramAvg([]parser.Value{inVec}, nil, &EvalNodeHelper{})
+		require.Len(t, avgOut, 1)
+		require.Equal(t, h.Sum/h.Count, avgOut[0].F)
+	})
+}
+
+func TestHoltWintersMean(t *testing.T) {
+	samples := []FPoint{{T: 0, F: 1}, {T: 1000, F: 2}, {T: 2000, F: 3}, {T: 3000, F: 100}}
+	require.InDelta(t, 2, holtWintersMean(samples, 0, 3), 1e-9)
+	require.InDelta(t, 51.5, holtWintersMean(samples, 2, 4), 1e-9)
+}
+
+func callHoltWintersSeasonal(floats []FPoint, sf, tf, seasonalFactor, period float64) (Vector, notes.Notes) {
+	metric := labels.FromStrings(labels.MetricName, "requests_total")
+	matrix := Matrix{Series{Metric: metric, Floats: floats}}
+	scalar := func(f float64) parser.Value { return Vector{{F: f}} }
+	return funcHoltWintersSeasonal(
+		[]parser.Value{matrix, scalar(sf), scalar(tf), scalar(seasonalFactor), scalar(period)},
+		nil, &EvalNodeHelper{},
+	)
+}
+
+func TestHoltWintersSeasonal(t *testing.T) {
+	t.Run("too few samples for one period", func(t *testing.T) {
+		floats := []FPoint{{T: 0, F: 1}, {T: 1000, F: 2}}
+		out, ns := callHoltWintersSeasonal(floats, 0.5, 0.5, 0.5, 60)
+		require.Empty(t, out)
+		require.ErrorIs(t, ns.Warnings[0], notes.RangeTooShortWarning)
+	})
+
+	t.Run("fewer than two full periods", func(t *testing.T) {
+		// 1s spacing, period of 3s implies a 3-sample period, but only 4
+		// samples are supplied, short of the 2*period required.
+		floats := make([]FPoint, 4)
+		for i := range floats {
+			floats[i] = FPoint{T: int64(i) * 1000, F: float64(i)}
+		}
+		out, ns := callHoltWintersSeasonal(floats, 0.5, 0.5, 0.5, 3)
+		require.Empty(t, out)
+		require.ErrorIs(t, ns.Warnings[0], notes.RangeTooShortWarning)
+	})
+
+	t.Run("flat signal forecasts the same constant", func(t *testing.T) {
+		// With every sample equal, level stays constant, trend and every
+		// seasonal index stay at zero throughout, so the one-step forecast
+		// should reproduce the constant exactly (mod floating-point noise
+		// from the Kahan-compensated running sums in holtWintersMean).
+		floats := make([]FPoint, 6)
+		for i := range floats {
+			floats[i] = FPoint{T: int64(i) * 1000, F: 10}
+		}
+		out, ns := callHoltWintersSeasonal(floats, 0.5, 0.5, 0.5, 2)
+		require.Empty(t, ns.Warnings)
+		require.Len(t, out, 1)
+		require.InDelta(t, 10, out[0].F, 1e-9)
+	})
+
+	t.Run("large offset with small variation needs compensation", func(t *testing.T) {
+		// A huge constant offset (beyond float64's ~1 part in 2^53 resolution)
+		// with a small seasonal+trend signal riding on top: every level/trend
+		// update here adds a small increment to an already-huge running value,
+		// where float64 rounding is at its coarsest. A flat signal (see above)
+		// never exercises this, since there's nothing small left to round away
+		// once the level settles.
+		const l = 4
+		n := 40
+		floats := make([]FPoint, n)
+		for i := range floats {
+			floats[i] = FPoint{
+				T: int64(i) * 1000,
+				F: 1e16 + float64(i%l)*20 + float64(i)*2,
+			}
+		}
+		const sf, tf, seasonalFactor = 0.3, 0.2, 0.4
+
+		out, ns := callHoltWintersSeasonal(floats, sf, tf, seasonalFactor, l)
+		require.Empty(t, ns.Warnings)
+		require.Len(t, out, 1)
+
+		want := holtWintersSeasonalBigFloatReference(floats, sf, tf, seasonalFactor, l)
+		// A handful of ULPs at this magnitude (ULP(1e16) == 2) is expected from
+		// ordinary float64 rounding. The recurrence is contractive, so rounding
+		// errors do not build up over the 40 iterations, and this tolerance
+		// does not by itself tell a compensated result from an uncompensated one.
+		require.InDelta(t, want, out[0].F, 8)
+	})
+}
+
+// holtWintersSeasonalBigFloatReference recomputes funcHoltWintersSeasonal's
+// recurrence using arbitrary-precision arithmetic, as a reference to check
+// the float64 result against.
+func holtWintersSeasonalBigFloatReference(floats []FPoint, sf, tf, seasonalFactor float64, l int) float64 {
+	const prec = 300
+	bf := func(f float64) *big.Float { return big.NewFloat(f).SetPrec(prec) }
+	one := bf(1)
+	sfB, tfB, seasonalFactorB := bf(sf), bf(tf), bf(seasonalFactor)
+	oneMinusSf := new(big.Float).SetPrec(prec).Sub(one, sfB)
+	oneMinusTf := new(big.Float).SetPrec(prec).Sub(one, tfB)
+	oneMinusSeasonalFactor := new(big.Float).SetPrec(prec).Sub(one, seasonalFactorB)
+
+	n := len(floats)
+	x := make([]*big.Float, n)
+	for i, f := range floats {
+		x[i] = bf(f.F)
+	}
+
+	mean := func(from, to int) *big.Float {
+		sum := bf(0)
+		for _, v := range x[from:to] {
+			sum.Add(sum, v)
+		}
+		return sum.Quo(sum, bf(float64(to-from)))
+	}
+
+	level := mean(0, l)
+	trend := new(big.Float).SetPrec(prec).Quo(new(big.Float).SetPrec(prec).Sub(mean(l, 2*l), level), bf(float64(l)))
+
+	seasonal := make([]*big.Float, n)
+	for i := 0; i < l; i++ {
+		seasonal[i] = new(big.Float).SetPrec(prec).Sub(x[i], level)
+	}
+
+	for i := l; i < n; i++ {
+		prevLevel, prevTrend := level, trend
+
+		term1 := new(big.Float).SetPrec(prec).Mul(sfB, new(big.Float).SetPrec(prec).Sub(x[i], seasonal[i-l]))
+		term2 := new(big.Float).SetPrec(prec).Mul(oneMinusSf, new(big.Float).SetPrec(prec).Add(prevLevel, prevTrend))
+		level = new(big.Float).SetPrec(prec).Add(term1, term2)
+
+		term3 := new(big.Float).SetPrec(prec).Mul(tfB, new(big.Float).SetPrec(prec).Sub(level, prevLevel))
+		term4 := new(big.Float).SetPrec(prec).Mul(oneMinusTf, prevTrend)
+		trend = new(big.Float).SetPrec(prec).Add(term3, term4)
+
+		term5 := new(big.Float).SetPrec(prec).Mul(seasonalFactorB, new(big.Float).SetPrec(prec).Sub(x[i], level))
+		term6 := new(big.Float).SetPrec(prec).Mul(oneMinusSeasonalFactor, seasonal[i-l])
+		seasonal[i] = new(big.Float).SetPrec(prec).Add(term5, term6)
+	}
+
+	result := new(big.Float).SetPrec(prec).Add(level, trend)
+	result.Add(result, seasonal[n-l])
+	f, _ := result.Float64()
+	return f
+}
@@ -14,12 +14,14 @@
 package annotations
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/prometheus/common/model"
 
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser/posrange"
 )
 
@@ -76,6 +78,28 @@ func (a *Annotations) Merge(aa Annotations) Annotations {
 	return *a
 }
 
+// MergeFromIngestion adds annotations raised by the ingestion path (e.g. remote-write
+// or OTLP translation rewriting or dropping samples for a series) in-place. Any
+// annotation built by this package's generic constructors with an empty metric name
+// gets the series' metric name filled in; no other labels of the series are recorded.
+// A query touching that series thus surfaces what happened to it at ingestion time
+// instead of requiring the user to correlate distributor logs.
+// The intended caller is the ingestion/storage path (e.g. an OTLP translator or
+// remote-write handler) that has access to both the raw and rewritten samples; that
+// code isn't part of this package, so NewCreatedTimestampInjectedInfo,
+// NewStalenessSynthesizedInfo, and NewOutOfOrderSampleRejectedInfo below are exercised
+// through this method rather than called directly from anywhere in this package.
+func (a *Annotations) MergeFromIngestion(lset labels.Labels, errs ...annoErr) Annotations {
+	metricName := lset.Get(labels.MetricName)
+	for _, err := range errs {
+		if ge, ok := err.(*genericAnnoErr); ok && ge.Metric == "" {
+			ge.Metric = metricName
+		}
+		a.Add(err)
+	}
+	return *a
+}
+
 // AsErrors is a convenience function to return the annotations map as a slice
 // of errors.
 func (a Annotations) AsErrors() []error {
@@ -136,6 +160,237 @@ func (a Annotations) CountWarningsAndInfo() (countWarnings, countInfo int) {
 	return
 }
 
+// isRawError reports whether err was added via AddRaw rather than one of this
+// package's own annotation constructors, unwrapping a single layer of
+// aggregation so a capped-and-aggregated raw error is still classified as raw.
+func isRawError(err annoErr) bool {
+	if agg, ok := err.(*aggregatedAnnoErr); ok {
+		err = agg.First
+	}
+	if ded, ok := err.(*dedupedAnnoErr); ok {
+		err = ded.annoErr
+	}
+	_, ok := err.(*rawErr)
+	return ok
+}
+
+// CountPromQLWarnings counts how many annotations were produced by this package's
+// own warning/info constructors (ratio, bad-bucket-label, mixed-classic-native,
+// forced-monotonicity, etc.) versus added as raw errors via AddRaw. Rule evaluation
+// and similar subsystems use this to increment a "produced warnings" metric only
+// when a genuine underlying failure occurred, not when PromQL merely emitted an
+// informational annotation.
+func (a Annotations) CountPromQLWarnings() (promqlWarnings, otherErrors int) {
+	for _, err := range a {
+		if isRawError(err) {
+			otherErrors++
+			continue
+		}
+		promqlWarnings++
+	}
+	return
+}
+
+// SplitPromQLWarnings splits the annotations into those produced by this package's
+// own warning/info constructors and those added as raw errors via AddRaw. See
+// CountPromQLWarnings for why this distinction matters to callers.
+func (a Annotations) SplitPromQLWarnings() (promql, other Annotations) {
+	promql, other = Annotations{}, Annotations{}
+	for key, err := range a {
+		if isRawError(err) {
+			other[key] = err
+			continue
+		}
+		promql[key] = err
+	}
+	return promql, other
+}
+
+// Severity classifies an annotation as either a warning or an info, matching the
+// distinction already made via errors.Is(err, PromQLWarning/PromQLInfo).
+type Severity string
+
+const (
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Policy bounds how many annotations a PolicedAnnotations will retain. It exists so
+// that streaming/step-invariant engines evaluating a range query at thousands of
+// timestamps don't balloon memory and response size with huge annotation sets.
+type Policy struct {
+	// MaxPerCode caps the number of distinct annotations retained per annotation
+	// code (0 means unlimited). Once the cap is reached, further occurrences of
+	// that code are aggregated into a single "N occurrences of X" entry instead
+	// of being added as new map entries.
+	MaxPerCode int
+	// MaxTotal caps the total number of distinct annotations retained across all
+	// codes (0 means unlimited), applied the same way as MaxPerCode.
+	MaxTotal int
+	// DropSeverity, if non-empty, restricts the capping above to annotations of
+	// this severity only; annotations of the other severity are never capped.
+	DropSeverity Severity
+}
+
+// aggregatedAnnoErr replaces a run of annotations that share a code once a Policy's
+// cap is reached, collapsing them into a single "N occurrences of X at positions
+// [...]" entry rather than retaining one map entry per position.
+type aggregatedAnnoErr struct {
+	Code      string
+	Severity  Severity
+	First     annoErr
+	Count     int
+	Positions []posrange.PositionRange
+}
+
+func (e *aggregatedAnnoErr) merge(_ annoErr) annoErr { return e }
+
+func (e *aggregatedAnnoErr) setQuery(query string) { e.First.setQuery(query) }
+
+func (e *aggregatedAnnoErr) Error() string {
+	return fmt.Sprintf("%s (%d occurrences of %s at positions %v)", e.First.Error(), e.Count, e.Code, e.Positions)
+}
+
+func (e *aggregatedAnnoErr) Unwrap() error { return e.First.Unwrap() }
+
+func (e *aggregatedAnnoErr) asStructured(query string) AnnotationInfo {
+	info := e.First.asStructured(query)
+	info.Message = e.Error()
+	info.Count = e.Count
+	if info.Details == nil {
+		info.Details = map[string]interface{}{}
+	}
+	info.Details["count"] = e.Count
+	info.Details["positions"] = e.Positions
+	return info
+}
+
+// PolicedAnnotations wraps Annotations with a Policy that caps how many distinct
+// entries are retained per code and in total, aggregating overflow instead of
+// letting the underlying map grow unbounded. It is meant to be constructed once per
+// query by the engine, which knows the step count up front and can pick a Policy
+// sized accordingly, then used in place of a bare Annotations for the rest of
+// evaluation; this package has no engine, so nothing here constructs one.
+type PolicedAnnotations struct {
+	Annotations
+	policy  Policy
+	perCode map[string]int
+	total   int
+}
+
+// NewWithPolicy returns PolicedAnnotations ready to use, enforcing policy on every
+// subsequent Add/AddRaw call.
+func NewWithPolicy(policy Policy) *PolicedAnnotations {
+	return &PolicedAnnotations{
+		Annotations: Annotations{},
+		policy:      policy,
+		perCode:     map[string]int{},
+	}
+}
+
+// Add adds an annotation, enforcing the configured Policy: once MaxPerCode or
+// MaxTotal is reached for annotations matching DropSeverity (or any severity, if
+// DropSeverity is unset), further additions of that code are folded into a single
+// aggregated entry rather than growing the map.
+func (a *PolicedAnnotations) Add(err annoErr) Annotations {
+	info := err.asStructured("")
+	capped := a.policy.DropSeverity == "" || Severity(info.Severity) == a.policy.DropSeverity
+	if capped && ((a.policy.MaxPerCode > 0 && a.perCode[info.Code] >= a.policy.MaxPerCode) ||
+		(a.policy.MaxTotal > 0 && a.total >= a.policy.MaxTotal)) {
+		if _, exists := a.Annotations[err.Error()]; exists {
+			// Merging into an entry already retained adds no distinct entry.
+			return a.Annotations.Add(err)
+		}
+		aggKey := "aggregated:" + info.Code
+		if existing, ok := a.Annotations[aggKey]; ok {
+			agg := existing.(*aggregatedAnnoErr)
+			agg.Count++
+			agg.Positions = append(agg.Positions, info.PositionRange)
+			return a.Annotations
+		}
+		a.Annotations[aggKey] = &aggregatedAnnoErr{
+			Code:      info.Code,
+			Severity:  Severity(info.Severity),
+			First:     err,
+			Count:     1,
+			Positions: []posrange.PositionRange{info.PositionRange},
+		}
+		return a.Annotations
+	}
+	if _, exists := a.Annotations[err.Error()]; !exists {
+		a.perCode[info.Code]++
+		a.total++
+	}
+	return a.Annotations.Add(err)
+}
+
+// AddRaw is like Add, but a convenience wrapper for adding raw errors instead of
+// annoErrs, enforcing the same Policy.
+func (a *PolicedAnnotations) AddRaw(err error) Annotations {
+	return a.Add(&rawErr{Err: err})
+}
+
+// LimitedAnnotations wraps Annotations with a hard per-kind cap so a single
+// pathological query (e.g. histogram_quantile over millions of malformed series)
+// cannot balloon memory or response size with an unbounded annotation set. Unlike
+// PolicedAnnotations, which aggregates overflow into a running "N occurrences"
+// entry per code, LimitedAnnotations simply drops anything past the cap and
+// records how many were dropped in a single AnnotationsTruncatedInfo per code.
+// Like PolicedAnnotations, it is meant to be constructed by the engine and used in
+// place of a bare Annotations for the duration of a query; no engine is part of
+// this package, so nothing here constructs one.
+type LimitedAnnotations struct {
+	Annotations
+	maxPerKind int
+	perKind    map[string]int
+	dropped    map[string]int
+}
+
+// NewLimitedAnnotations returns a LimitedAnnotations capping each annotation code
+// at maxPerKind retained entries. maxPerKind <= 0 means unlimited.
+func NewLimitedAnnotations(maxPerKind int) *LimitedAnnotations {
+	return &LimitedAnnotations{
+		Annotations: Annotations{},
+		maxPerKind:  maxPerKind,
+		perKind:     map[string]int{},
+		dropped:     map[string]int{},
+	}
+}
+
+// WithLimit sets the per-kind cap on an existing LimitedAnnotations and returns it
+// for convenience, e.g. when the cap is only known after reading per-tenant config.
+func (a *LimitedAnnotations) WithLimit(maxPerKind int) *LimitedAnnotations {
+	a.maxPerKind = maxPerKind
+	return a
+}
+
+// Add adds an annotation, enforcing the configured cap: once a code has
+// maxPerKind retained entries, further occurrences of that code are dropped and
+// rolled into a single AnnotationsTruncatedInfo recording how many were lost.
+func (a *LimitedAnnotations) Add(err annoErr) Annotations {
+	if a.maxPerKind <= 0 {
+		return a.Annotations.Add(err)
+	}
+	if _, exists := a.Annotations[err.Error()]; exists {
+		// Merging into an entry already retained adds no new entry.
+		return a.Annotations.Add(err)
+	}
+	info := err.asStructured("")
+	if a.perKind[info.Code] >= a.maxPerKind {
+		a.dropped[info.Code]++
+		a.Annotations["truncated:"+info.Code] = NewAnnotationsTruncatedInfo(info.Code, a.dropped[info.Code], info.PositionRange)
+		return a.Annotations
+	}
+	a.perKind[info.Code]++
+	return a.Annotations.Add(err)
+}
+
+// AddRaw is like Add, but a convenience wrapper for adding raw errors instead of
+// annoErrs, enforcing the same cap.
+func (a *LimitedAnnotations) AddRaw(err error) Annotations {
+	return a.Add(&rawErr{Err: err})
+}
+
 //nolint:revive // error-naming.
 var (
 	// Currently there are only 2 types, warnings and info.
@@ -154,11 +409,22 @@ var (
 	NativeHistogramNotGaugeWarning             = fmt.Errorf("%w: this native histogram metric is not a gauge:", PromQLWarning)
 	MixedExponentialCustomHistogramsWarning    = fmt.Errorf("%w: vector contains a mix of histograms with exponential and custom buckets schemas for metric name", PromQLWarning)
 	IncompatibleCustomBucketsHistogramsWarning = fmt.Errorf("%w: vector contains histograms with incompatible custom buckets for metric name", PromQLWarning)
+	IncompatibleBucketLayoutInBinOpWarning     = fmt.Errorf("%w: combining histograms with incompatible custom bucket layouts for binary operator", PromQLWarning)
+	MixedSchemaAggregationWarning              = fmt.Errorf("%w: vector contains histograms with mismatched schemas for aggregation", PromQLWarning)
 
 	PossibleNonCounterInfo                  = fmt.Errorf("%w: metric might not be a counter, name does not end in _total/_sum/_count/_bucket:", PromQLInfo)
 	HistogramQuantileForcedMonotonicityInfo = fmt.Errorf("%w: input to histogram_quantile needed to be fixed for monotonicity (see https://prometheus.io/docs/prometheus/latest/querying/functions/#histogram_quantile) for metric name", PromQLInfo)
 	IncompatibleTypesInBinOpInfo            = fmt.Errorf("%w: incompatible sample types encountered for binary operator", PromQLInfo)
 	HistogramIgnoredInAggregationInfo       = fmt.Errorf("%w: ignored histogram in", PromQLInfo)
+	CustomBucketsQuantileInterpolationInfo  = fmt.Errorf("%w: histogram_quantile interpolated across a wide custom bucket for metric name", PromQLInfo)
+	AnnotationsTruncatedInfo                = fmt.Errorf("%w: further annotations of this kind were truncated", PromQLInfo)
+
+	// IngestionInfo annotations surface what the ingestion path (remote-write/OTLP)
+	// did to a series before it ever reached storage, e.g. rewriting or synthesizing
+	// samples, so query results can explain themselves without distributor logs.
+	CreatedTimestampInjectedInfo = fmt.Errorf("%w: a zero sample was synthesized at the OTLP start timestamp for", PromQLInfo)
+	StalenessSynthesizedInfo     = fmt.Errorf("%w: a staleness marker was synthesized during ingestion for", PromQLInfo)
+	OutOfOrderSampleRejectedInfo = fmt.Errorf("%w: an out-of-order sample was rejected during ingestion for", PromQLInfo)
 )
 
 type annoErr interface {
@@ -171,6 +437,154 @@ type annoErr interface {
 	setQuery(string)
 	// Necessary so we can use errors.Is() to disambiguate between warning and info.
 	Unwrap() error
+	// asStructured returns a structured, typed representation of the annotation for
+	// programmatic consumption, e.g. by API clients that want to dispatch on code
+	// and position rather than regex-matching the human-readable message.
+	asStructured(query string) AnnotationInfo
+}
+
+// Position is the structured, line/column-resolved form of a posrange.PositionRange,
+// so that JSON consumers can highlight the offending span without re-implementing
+// the parser's own byte-offset-to-line/column counting.
+type Position struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	Line  int `json:"line"`
+	Col   int `json:"col"`
+}
+
+// newPosition resolves pr against query to fill in Line and Col. If query is
+// empty, Line and Col are left at zero, since offsets cannot be resolved without
+// it; Start and End are filled in either way.
+func newPosition(pr posrange.PositionRange, query string) Position {
+	pos := Position{Start: int(pr.Start), End: int(pr.End)}
+	if query == "" {
+		return pos
+	}
+	pos.Line, pos.Col = 1, 1
+	for i, r := range query {
+		if i >= pos.Start {
+			break
+		}
+		if r == '\n' {
+			pos.Line++
+			pos.Col = 1
+		} else {
+			pos.Col++
+		}
+	}
+	return pos
+}
+
+// AnnotationInfo is a structured representation of a single annotation, meant for
+// clients (such as Grafana or alerting UIs) that want to dispatch on the annotation
+// code and highlight the offending PromQL span instead of parsing the message string.
+type AnnotationInfo struct {
+	// Code is a stable, machine-readable identifier for the kind of annotation,
+	// e.g. "InvalidRatioWarning".
+	Code string `json:"code"`
+	// Severity is either "warning" or "info".
+	Severity string `json:"severity"`
+	// Message is the rendered, human-readable annotation, identical to what
+	// AsStrings would have returned for this entry.
+	Message string `json:"message"`
+	// PositionRange is the range in Query that triggered the annotation.
+	PositionRange posrange.PositionRange `json:"positionRange"`
+	// Position is PositionRange resolved to a line and column within Query, for
+	// clients that want to highlight the span without parsing Message.
+	Position Position `json:"position"`
+	// Query is the query string the annotation was raised for.
+	Query string `json:"query,omitempty"`
+	// Metric is the metric name this annotation pertains to, if any.
+	Metric string `json:"metric,omitempty"`
+	// Details carries type-specific payload, e.g. the min/max bucket bounds
+	// tracked by histogramQuantileForcedMonotonicityErr.
+	Details map[string]interface{} `json:"details,omitempty"`
+	// Count is the number of occurrences an entry stands for after Dedupe, or
+	// after a Policy folded overflow into an aggregated entry; it is omitted for
+	// entries that went through neither.
+	Count int `json:"count,omitempty"`
+}
+
+// AsStructured returns the annotations as structured objects rather than flat
+// strings, so that API clients can programmatically dispatch on annotation code
+// and position instead of regex-matching the human-readable message. query may be
+// empty, in which case each annotation falls back to the query it was last given
+// via AsStrings or a prior AsStructured call, if any.
+func (a Annotations) AsStructured(query string) []AnnotationInfo {
+	infos := make([]AnnotationInfo, 0, len(a))
+	for _, err := range a {
+		if query != "" {
+			err.setQuery(query)
+		}
+		infos = append(infos, err.asStructured(query))
+	}
+	return infos
+}
+
+// MarshalJSON implements json.Marshaler, serializing the annotations using the
+// structured form from AsStructured so API responses carry typed fields (code,
+// severity, message, position, details) instead of forcing consumers to
+// regex-parse the strings AsStrings returns.
+func (a Annotations) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.AsStructured(""))
+}
+
+// Dedupe collapses annotations that share the same code, metric, and position into
+// a single entry, appending a "(occurred N times)" suffix to the message and
+// setting Count in the structured form. This complements the exact-string merging
+// Add already does: that only catches byte-identical messages, so e.g. two
+// InvalidRatioWarnings for the same metric at the same position but different
+// ratio values would otherwise surface as separate, nearly-identical lines.
+func (a Annotations) Dedupe() Annotations {
+	type groupKey struct {
+		code   string
+		metric string
+		pos    posrange.PositionRange
+		raw    string
+	}
+	groups := map[groupKey]*dedupedAnnoErr{}
+	deduped := Annotations{}
+	for key, err := range a {
+		info := err.asStructured("")
+		gk := groupKey{code: info.Code, metric: info.Metric, pos: info.PositionRange}
+		if isRawError(err) {
+			// Raw errors (added via AddRaw) carry no structured position or
+			// metric to key on, so two unrelated raw errors would otherwise
+			// collapse into the same group; key on the message too.
+			gk.raw = info.Message
+		}
+		if existing, ok := groups[gk]; ok {
+			existing.count++
+			continue
+		}
+		d := &dedupedAnnoErr{annoErr: err, count: 1}
+		groups[gk] = d
+		deduped[key] = d
+	}
+	return deduped
+}
+
+// dedupedAnnoErr wraps an annoErr that absorbed count-1 other annotations sharing
+// its code, metric, and position via Dedupe, so the client sees one line with an
+// "(occurred N times)" suffix instead of N near-identical ones.
+type dedupedAnnoErr struct {
+	annoErr
+	count int
+}
+
+func (e *dedupedAnnoErr) Error() string {
+	if e.count <= 1 {
+		return e.annoErr.Error()
+	}
+	return fmt.Sprintf("%s (occurred %d times)", e.annoErr.Error(), e.count)
+}
+
+func (e *dedupedAnnoErr) asStructured(query string) AnnotationInfo {
+	info := e.annoErr.asStructured(query)
+	info.Message = e.Error()
+	info.Count = e.count
+	return info
 }
 
 type rawErr struct {
@@ -191,10 +605,24 @@ func (e *rawErr) Unwrap() error {
 	return e.Err
 }
 
+func (e *rawErr) asStructured(_ string) AnnotationInfo {
+	return AnnotationInfo{
+		Code:     "RawError",
+		Severity: "warning",
+		Message:  e.Error(),
+	}
+}
+
 type genericAnnoErr struct {
 	PositionRange posrange.PositionRange
 	Err           error
 	Query         string
+	// Code is the stable identifier surfaced via AsStructured, e.g. "InvalidRatioWarning".
+	Code string
+	// Metric is the metric name this annotation pertains to, if any.
+	Metric string
+	// Details carries any additional type-specific payload for AsStructured.
+	Details map[string]interface{}
 }
 
 func (e *genericAnnoErr) merge(_ annoErr) annoErr {
@@ -216,12 +644,34 @@ func (e *genericAnnoErr) Unwrap() error {
 	return e.Err
 }
 
+func (e *genericAnnoErr) asStructured(query string) AnnotationInfo {
+	if query == "" {
+		query = e.Query
+	}
+	severity := "warning"
+	if errors.Is(e, PromQLInfo) {
+		severity = "info"
+	}
+	return AnnotationInfo{
+		Code:          e.Code,
+		Severity:      severity,
+		Message:       e.Error(),
+		PositionRange: e.PositionRange,
+		Position:      newPosition(e.PositionRange, query),
+		Query:         query,
+		Metric:        e.Metric,
+		Details:       e.Details,
+	}
+}
+
 // NewInvalidQuantileWarning is used when the user specifies an invalid quantile
 // value, i.e. a float that is outside the range [0, 1] or NaN.
 func NewInvalidQuantileWarning(q float64, pos posrange.PositionRange) annoErr {
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w, got %g", InvalidQuantileWarning, q),
+		Code:          "InvalidQuantileWarning",
+		Details:       map[string]interface{}{"quantile": q},
 	}
 }
 
@@ -231,6 +681,8 @@ func NewInvalidRatioWarning(q, to float64, pos posrange.PositionRange) annoErr {
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w, got %g, capping to %g", InvalidRatioWarning, q, to),
+		Code:          "InvalidRatioWarning",
+		Details:       map[string]interface{}{"ratio": q, "cappedTo": to},
 	}
 }
 
@@ -240,6 +692,9 @@ func NewBadBucketLabelWarning(metricName, label string, pos posrange.PositionRan
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w of %q for metric name %q", BadBucketLabelWarning, label, metricName),
+		Code:          "BadBucketLabelWarning",
+		Metric:        metricName,
+		Details:       map[string]interface{}{"label": label},
 	}
 }
 
@@ -250,6 +705,8 @@ func NewMixedFloatsHistogramsWarning(metricName string, pos posrange.PositionRan
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w metric name %q", MixedFloatsHistogramsWarning, metricName),
+		Code:          "MixedFloatsHistogramsWarning",
+		Metric:        metricName,
 	}
 }
 
@@ -259,6 +716,7 @@ func NewMixedFloatsHistogramsAggWarning(pos posrange.PositionRange) annoErr {
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w aggregation", MixedFloatsHistogramsWarning),
+		Code:          "MixedFloatsHistogramsWarning",
 	}
 }
 
@@ -268,6 +726,8 @@ func NewMixedClassicNativeHistogramsWarning(metricName string, pos posrange.Posi
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %q", MixedClassicNativeHistogramsWarning, metricName),
+		Code:          "MixedClassicNativeHistogramsWarning",
+		Metric:        metricName,
 	}
 }
 
@@ -277,6 +737,8 @@ func NewNativeHistogramNotCounterWarning(metricName string, pos posrange.Positio
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %q", NativeHistogramNotCounterWarning, metricName),
+		Code:          "NativeHistogramNotCounterWarning",
+		Metric:        metricName,
 	}
 }
 
@@ -286,15 +748,21 @@ func NewNativeHistogramNotGaugeWarning(metricName string, pos posrange.PositionR
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %q", NativeHistogramNotGaugeWarning, metricName),
+		Code:          "NativeHistogramNotGaugeWarning",
+		Metric:        metricName,
 	}
 }
 
-// NewMixedExponentialCustomHistogramsWarning is used when the queried series includes
-// histograms with both exponential and custom buckets schemas.
-func NewMixedExponentialCustomHistogramsWarning(metricName string, pos posrange.PositionRange) annoErr {
+// NewMixedExponentialCustomHistogramsWarning is used when an aggregation or rate
+// function sees histograms with both exponential and custom buckets schemas for
+// the same series set.
+func NewMixedExponentialCustomHistogramsWarning(funcName, metricName string, pos posrange.PositionRange) annoErr {
 	return &genericAnnoErr{
 		PositionRange: pos,
-		Err:           fmt.Errorf("%w %q", MixedExponentialCustomHistogramsWarning, metricName),
+		Err:           fmt.Errorf("%w %q: %s", MixedExponentialCustomHistogramsWarning, metricName, funcName),
+		Code:          "MixedExponentialCustomHistogramsWarning",
+		Metric:        metricName,
+		Details:       map[string]interface{}{"function": funcName},
 	}
 }
 
@@ -304,6 +772,81 @@ func NewIncompatibleCustomBucketsHistogramsWarning(metricName string, pos posran
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %q", IncompatibleCustomBucketsHistogramsWarning, metricName),
+		Code:          "IncompatibleCustomBucketsHistogramsWarning",
+		Metric:        metricName,
+	}
+}
+
+// NewIncompatibleBucketLayoutInBinOpWarning is used when a binary operator is applied to two
+// custom-bucket native histograms whose bucket boundaries don't match. Binary operator
+// evaluation lives in the engine rather than in this package, so the engine is the
+// intended caller; see NewMixedSchemaAggregationWarning for the corresponding aggregation
+// case, which has the same caveat.
+func NewIncompatibleBucketLayoutInBinOpWarning(operator string, pos posrange.PositionRange) annoErr {
+	return &genericAnnoErr{
+		PositionRange: pos,
+		Err:           fmt.Errorf("%w: %s", IncompatibleBucketLayoutInBinOpWarning, operator),
+		Code:          "IncompatibleBucketLayoutInBinOpWarning",
+		Details:       map[string]interface{}{"operator": operator},
+	}
+}
+
+// NewMixedSchemaAggregationWarning is used when an aggregation such as sum or avg
+// combines native histograms whose schemas don't match, e.g. exponential buckets of
+// differing resolution or custom buckets with differing boundaries. Aggregation
+// operators (as opposed to the *_over_time range-vector functions) are evaluated in
+// the engine rather than in this package, so the engine is the intended caller.
+func NewMixedSchemaAggregationWarning(metricName string, pos posrange.PositionRange) annoErr {
+	return &genericAnnoErr{
+		PositionRange: pos,
+		Err:           fmt.Errorf("%w %q", MixedSchemaAggregationWarning, metricName),
+		Code:          "MixedSchemaAggregationWarning",
+		Metric:        metricName,
+	}
+}
+
+// NewCustomBucketsQuantileInterpolationInfo is used when histogram_quantile has to
+// interpolate the requested quantile across a custom bucket that is wide relative to
+// the overall histogram range, so the result carries more uncertainty than usual.
+func NewCustomBucketsQuantileInterpolationInfo(metricName string, pos posrange.PositionRange) annoErr {
+	return &genericAnnoErr{
+		PositionRange: pos,
+		Err:           fmt.Errorf("%w %q", CustomBucketsQuantileInterpolationInfo, metricName),
+		Code:          "CustomBucketsQuantileInterpolationInfo",
+		Metric:        metricName,
+	}
+}
+
+// NewCreatedTimestampInjectedInfo is used when the OTLP ingestion path synthesizes a
+// zero-value sample at a series' start timestamp to establish a counter's created time.
+func NewCreatedTimestampInjectedInfo(metricName string, pos posrange.PositionRange) annoErr {
+	return &genericAnnoErr{
+		PositionRange: pos,
+		Err:           fmt.Errorf("%w %q", CreatedTimestampInjectedInfo, metricName),
+		Code:          "CreatedTimestampInjectedInfo",
+		Metric:        metricName,
+	}
+}
+
+// NewStalenessSynthesizedInfo is used when the ingestion path synthesizes a staleness
+// marker for a series, e.g. because it stopped being scraped/exported.
+func NewStalenessSynthesizedInfo(metricName string, pos posrange.PositionRange) annoErr {
+	return &genericAnnoErr{
+		PositionRange: pos,
+		Err:           fmt.Errorf("%w %q", StalenessSynthesizedInfo, metricName),
+		Code:          "StalenessSynthesizedInfo",
+		Metric:        metricName,
+	}
+}
+
+// NewOutOfOrderSampleRejectedInfo is used when the ingestion path drops a sample for
+// a series because it arrived out of order.
+func NewOutOfOrderSampleRejectedInfo(metricName string, pos posrange.PositionRange) annoErr {
+	return &genericAnnoErr{
+		PositionRange: pos,
+		Err:           fmt.Errorf("%w %q", OutOfOrderSampleRejectedInfo, metricName),
+		Code:          "OutOfOrderSampleRejectedInfo",
+		Metric:        metricName,
 	}
 }
 
@@ -313,6 +856,8 @@ func NewPossibleNonCounterInfo(metricName string, pos posrange.PositionRange) an
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %q", PossibleNonCounterInfo, metricName),
+		Code:          "PossibleNonCounterInfo",
+		Metric:        metricName,
 	}
 }
 
@@ -320,6 +865,7 @@ type histogramQuantileForcedMonotonicityErr struct {
 	PositionRange posrange.PositionRange
 	Err           error
 	Query         string
+	Metric        string
 	Min           []float64
 	Max           []float64
 	Count         int
@@ -364,6 +910,29 @@ func (e *histogramQuantileForcedMonotonicityErr) Unwrap() error {
 	return e.Err
 }
 
+func (e *histogramQuantileForcedMonotonicityErr) asStructured(query string) AnnotationInfo {
+	if query == "" {
+		query = e.Query
+	}
+	return AnnotationInfo{
+		Code:          "HistogramQuantileForcedMonotonicityInfo",
+		Severity:      "info",
+		Message:       e.Error(),
+		PositionRange: e.PositionRange,
+		Position:      newPosition(e.PositionRange, query),
+		Query:         query,
+		Metric:        e.Metric,
+		Details: map[string]interface{}{
+			"minBucketBound": e.Min[1],
+			"maxBucketBound": e.Max[1],
+			"maxDiff":        e.Max[2],
+			"startTimestamp": e.Min[0],
+			"endTimestamp":   e.Max[0],
+			"sampleCount":    e.Count + 1,
+		},
+	}
+}
+
 // NewHistogramQuantileForcedMonotonicityInfo is used when the input (classic histograms) to
 // histogram_quantile needs to be forced to be monotonic.
 func NewHistogramQuantileForcedMonotonicityInfo(metricName string, pos posrange.PositionRange, ts int64, forcedMonotonicMinBucket, forcedMonotonicMaxBucket, forcedMonotonicMaxDiff float64) annoErr {
@@ -371,6 +940,7 @@ func NewHistogramQuantileForcedMonotonicityInfo(metricName string, pos posrange.
 	return &histogramQuantileForcedMonotonicityErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %q", HistogramQuantileForcedMonotonicityInfo, metricName),
+		Metric:        metricName,
 		Min:           []float64{floatTs, forcedMonotonicMinBucket},
 		Max:           []float64{floatTs, forcedMonotonicMaxBucket, forcedMonotonicMaxDiff},
 	}
@@ -382,6 +952,8 @@ func NewIncompatibleTypesInBinOpInfo(lhsType, operator, rhsType string, pos posr
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %q: %s %s %s", IncompatibleTypesInBinOpInfo, operator, lhsType, operator, rhsType),
+		Code:          "IncompatibleTypesInBinOpInfo",
+		Details:       map[string]interface{}{"lhsType": lhsType, "operator": operator, "rhsType": rhsType},
 	}
 }
 
@@ -391,5 +963,20 @@ func NewHistogramIgnoredInAggregationInfo(aggregation string, pos posrange.Posit
 	return &genericAnnoErr{
 		PositionRange: pos,
 		Err:           fmt.Errorf("%w %s aggregation", HistogramIgnoredInAggregationInfo, aggregation),
+		Code:          "HistogramIgnoredInAggregationInfo",
+		Details:       map[string]interface{}{"aggregation": aggregation},
+	}
+}
+
+// NewAnnotationsTruncatedInfo is used by LimitedAnnotations when it drops further
+// occurrences of kind after reaching its per-kind cap, so callers know the
+// retained set for that kind is not exhaustive and dropped records how many were
+// discarded so far.
+func NewAnnotationsTruncatedInfo(kind string, dropped int, pos posrange.PositionRange) annoErr {
+	return &genericAnnoErr{
+		PositionRange: pos,
+		Err:           fmt.Errorf("%w: %d more %q annotations dropped", AnnotationsTruncatedInfo, dropped, kind),
+		Code:          "AnnotationsTruncatedInfo",
+		Details:       map[string]interface{}{"kind": kind, "dropped": dropped},
 	}
 }
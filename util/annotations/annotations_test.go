@@ -15,6 +15,7 @@ package annotations
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -48,3 +49,64 @@ func TestAnnotations_AsStrings(t *testing.T) {
 		`PromQL info: input to histogram_quantile needed to be fixed for monotonicity (see https://prometheus.io/docs/prometheus/latest/querying/functions/#histogram_quantile) for metric name "series_1", from buckets 2.5 to 100, with a max diff of 10, over 3 samples from 2023-12-25T00:00:00Z to 2024-12-25T00:00:00Z (1:4)`,
 	})
 }
+
+func TestPolicedAnnotations_AddRaw(t *testing.T) {
+	annos := NewWithPolicy(Policy{MaxPerCode: 3})
+	for i := 0; i < 10; i++ {
+		annos.AddRaw(fmt.Errorf("raw error %d", i))
+	}
+	require.Len(t, annos.Annotations, 4, "3 retained plus 1 aggregated entry, not 10")
+	require.Contains(t, annos.Annotations, "aggregated:RawError")
+}
+
+func TestLimitedAnnotations_AddRaw(t *testing.T) {
+	annos := NewLimitedAnnotations(3)
+	for i := 0; i < 10; i++ {
+		annos.AddRaw(fmt.Errorf("raw error %d", i))
+	}
+	require.Len(t, annos.Annotations, 4, "3 retained plus 1 truncated marker, not 10")
+	require.Contains(t, annos.Annotations, "truncated:RawError")
+}
+
+func TestAnnotations_Dedupe(t *testing.T) {
+	pos := posrange.PositionRange{Start: 3, End: 8}
+
+	t.Run("same code, metric, and position merge", func(t *testing.T) {
+		var annos Annotations
+		annos.Add(NewInvalidRatioWarning(1.1, 100, pos))
+		annos.Add(NewInvalidRatioWarning(1.2, 123, pos))
+
+		deduped := annos.Dedupe()
+		require.Len(t, deduped, 1)
+	})
+
+	t.Run("distinct raw errors do not merge", func(t *testing.T) {
+		var annos Annotations
+		annos.AddRaw(errors.New("first raw error"))
+		annos.AddRaw(errors.New("second raw error"))
+		require.Len(t, annos, 2, "distinct messages should not merge even before Dedupe")
+
+		deduped := annos.Dedupe()
+		require.Len(t, deduped, 2, "two unrelated raw errors collapsed into one")
+
+		infos := deduped.AsStructured("")
+		messages := make([]string, len(infos))
+		for i, info := range infos {
+			messages[i] = info.Message
+		}
+		require.ElementsMatch(t, messages, []string{"first raw error", "second raw error"})
+	})
+}
+
+func TestAnnotations_SplitPromQLWarnings_AfterDedupe(t *testing.T) {
+	var annos Annotations
+	annos.AddRaw(errors.New("raw error"))
+	annos.Add(NewInvalidRatioWarning(1.1, 100, posrange.PositionRange{Start: 3, End: 8}))
+
+	deduped := annos.Dedupe()
+	require.Len(t, deduped, 2)
+
+	promql, other := deduped.SplitPromQLWarnings()
+	require.Len(t, other, 1, "the deduped raw error should still be classified as raw, not a PromQL warning")
+	require.Len(t, promql, 1)
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notes carries the per-step diagnostics produced while evaluating a single
+// PromQL FunctionCall (see promql.FunctionCall). They are lighter weight than
+// util/annotations.Annotations, which is the query-wide container the engine folds
+// these into once evaluation of all steps and series is complete.
+package notes
+
+import (
+	"fmt"
+)
+
+// Notes collects the warnings and infos raised while evaluating a single function
+// call. The zero value is ready to use.
+type Notes struct {
+	Warnings []error
+	Infos    []error
+}
+
+// AddWarning appends a warning to n.
+func (n *Notes) AddWarning(err error) {
+	n.Warnings = append(n.Warnings, err)
+}
+
+// AddInfo appends an info-level note to n. If err is a *RateExtrapolationInfo for
+// a metric that already has one in n, the two are merged by taking the larger
+// extrapolation factor instead of keeping both.
+func (n *Notes) AddInfo(err error) {
+	if re, ok := err.(*RateExtrapolationInfo); ok {
+		for _, existing := range n.Infos {
+			if existingRE, ok := existing.(*RateExtrapolationInfo); ok && existingRE.metricName == re.metricName {
+				if re.extrapolationFactor > existingRE.extrapolationFactor {
+					existingRE.extrapolationFactor = re.extrapolationFactor
+				}
+				return
+			}
+		}
+	}
+	n.Infos = append(n.Infos, err)
+}
+
+// Merge appends the warnings of other onto n and adds its infos via AddInfo, so
+// RateExtrapolationInfos for the same metric keep only the larger factor.
+func (n *Notes) Merge(other Notes) {
+	n.Warnings = append(n.Warnings, other.Warnings...)
+	for _, info := range other.Infos {
+		n.AddInfo(info)
+	}
+}
+
+// CreateNotesWithWarning is a convenience constructor for the common case of a
+// function bailing out early with a single warning.
+func CreateNotesWithWarning(err error) Notes {
+	return Notes{Warnings: []error{err}}
+}
+
+//nolint:revive // error-naming.
+var (
+	RangeTooShortWarning         = fmt.Errorf("vector contains too few samples to calculate the result")
+	MixedFloatsHistogramsWarning = fmt.Errorf("encountered a mix of histograms and floats")
+	MixedOldNewHistogramsWarning = fmt.Errorf("vector contains a mix of classic and native histograms for metric name")
+)
+
+// NewInvalidQuantileWarning is used when the user specifies an invalid quantile
+// value, i.e. a float that is outside the range [0, 1] or NaN.
+func NewInvalidQuantileWarning(q float64) error {
+	return fmt.Errorf("quantile value should be between 0 and 1, got %g", q)
+}
+
+// NewBadBucketLabelWarning is used when there is an error parsing the bucket label
+// of a classic histogram.
+func NewBadBucketLabelWarning(label string) error {
+	return fmt.Errorf("bucket label %q is missing or has a malformed value", label)
+}
+
+// NewPossibleNonCounterWarning is used when a named counter metric does not
+// have any of the suffixes _total, _sum, or _count, so there is no naming
+// evidence at all that it is a counter.
+func NewPossibleNonCounterWarning(metricName string) error {
+	return fmt.Errorf("metric might not be a counter, name does not end in _total/_sum/_count: %q", metricName)
+}
+
+// NewPossibleNonCounterInfo is used when a named counter metric has the _sum
+// or _count suffix. Unlike a fully unrecognized name, these are often (but not
+// always) counters, so the note is raised at info rather than warning level.
+func NewPossibleNonCounterInfo(metricName string) error {
+	return fmt.Errorf("metric name %q ends in _sum/_count, which is usually but not always a counter", metricName)
+}
+
+// RateExtrapolationInfo is raised by rate/increase/delta when the first or last
+// sample lies more than 1.1 average sample intervals away from its range
+// boundary. extrapolationFactor is the larger of those two gaps, measured in
+// average sample intervals; AddInfo and Merge keep the largest factor seen for a
+// metric.
+type RateExtrapolationInfo struct {
+	metricName          string
+	extrapolationFactor float64
+}
+
+func (e *RateExtrapolationInfo) Error() string {
+	return fmt.Sprintf("result for metric name %q: a range boundary is %.2f average sample intervals away from the nearest sample, consider a longer range or a less sparse counter", e.metricName, e.extrapolationFactor)
+}
+
+// NewRateExtrapolationInfo is used when rate/increase/delta finds a range
+// boundary far from the nearest sample, relative to the average sample interval.
+func NewRateExtrapolationInfo(metricName string, extrapolationFactor float64) error {
+	return &RateExtrapolationInfo{metricName: metricName, extrapolationFactor: extrapolationFactor}
+}
+
+// MixedTypesDroppedInfo is raised when a range vector contains both float and
+// histogram samples for a metric and the function has no defined way to
+// combine them, so the vector element was dropped from the result rather than
+// silently treated as "no data".
+type MixedTypesDroppedInfo struct {
+	metric         string
+	floatCount     int
+	histogramCount int
+}
+
+func (e *MixedTypesDroppedInfo) Error() string {
+	return fmt.Sprintf("vector element for metric name %q dropped: range contained %d float sample(s) and %d histogram sample(s), which cannot be combined", e.metric, e.floatCount, e.histogramCount)
+}
+
+// NewMixedTypesDroppedInfo is used when a function drops a vector element
+// because its range contains both floats and histograms.
+func NewMixedTypesDroppedInfo(metric string, floatCount, histogramCount int) error {
+	return &MixedTypesDroppedInfo{metric: metric, floatCount: floatCount, histogramCount: histogramCount}
+}
+
+// HistogramsIgnoredInfo is raised when a function has no histogram-aware
+// implementation and silently ignored the histogram samples present in its
+// input, rather than the caller mistaking the result for "no data".
+type HistogramsIgnoredInfo struct {
+	funcName string
+	metric   string
+}
+
+func (e *HistogramsIgnoredInfo) Error() string {
+	return fmt.Sprintf("%s does not support histograms and ignored them for metric name %q", e.funcName, e.metric)
+}
+
+// CounterResetHintMismatchInfo is raised by rate/increase/delta when a native
+// histogram sample's CounterResetHint disagrees with whether the calling
+// function expects a counter (rate/increase) or a gauge (delta).
+type CounterResetHintMismatchInfo struct {
+	metric string
+}
+
+func (e *CounterResetHintMismatchInfo) Error() string {
+	return fmt.Sprintf("metric name %q has a counter reset hint that is inconsistent with the function called on it", e.metric)
+}
+
+// NewCounterResetHintMismatchInfo is used when a histogram sample's
+// CounterResetHint does not match the isCounter expectation of the calling
+// function.
+func NewCounterResetHintMismatchInfo(metric string) error {
+	return &CounterResetHintMismatchInfo{metric: metric}
+}
+
+// NewHistogramsIgnoredInfo is used when a function ignores histogram samples
+// in its input because it has no defined behavior for them.
+func NewHistogramsIgnoredInfo(funcName, metric string) error {
+	return &HistogramsIgnoredInfo{funcName: funcName, metric: metric}
+}